@@ -3,6 +3,7 @@ module design-your-tesla/backend
 go 1.22
 
 require (
+	github.com/go-pdf/fpdf v0.9.0
 	github.com/golang-jwt/jwt/v5 v5.2.1
 	github.com/mattn/go-sqlite3 v1.14.24
 	golang.org/x/crypto v0.31.0
@@ -1,28 +1,83 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
+	mathrand "math/rand/v2"
+	"net"
 	"net/http"
+	"net/http/pprof"
+	"net/netip"
+	"net/url"
 	"os"
 	"regexp"
+	"runtime"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/go-pdf/fpdf"
 	"github.com/golang-jwt/jwt/v5"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 	"golang.org/x/crypto/bcrypt"
 )
 
 const (
-	defaultAdminSecret = "admin-dev-secret"
-	defaultJWTSecret   = "dev-only-change-me"
-	tokenTTL           = 7 * 24 * time.Hour
+	defaultAdminSecret   = "admin-dev-secret"
+	defaultJWTSecret     = "dev-only-change-me"
+	tokenTTL             = 7 * 24 * time.Hour
+	defaultPasswordMin   = 8
+	maxThumbnailBytes    = 2 << 20
+	maxImportBytes       = 1 << 20
+	idempotencyKeyTTL    = 24 * time.Hour
+	maxIdempotencyKeyLen = 255
+	draftCleanupInterval = time.Hour
+	defaultPageLimit     = 50
+	maxPageLimit         = 200
+	defaultAnalyticsTopN = 5
+	defaultRecentLimit   = 10
+	maxRecentLimit       = 50
+	maxAnalyticsTopN     = 50
+	gzipMinSize          = 1024
+	maxBatchDesigns      = 50
+	lowContrastDistance  = 32
+	minFrameContrast     = 1.5
+	defaultColorHex      = "#111317"
+	authCookieName       = "auth_token"
+	busyRetryBaseDelay   = 25 * time.Millisecond
+	busyRetryMaxWait     = 2 * time.Second
+)
+
+var (
+	buildVersion = "dev"
+	buildCommit  = "unknown"
+	buildTime    = "unknown"
+)
+
+type contextKey string
+
+const (
+	handlerKey   contextKey = "handler"
+	requestIDKey contextKey = "requestID"
 )
 
 type designStatus string
@@ -34,15 +89,177 @@ const (
 	statusSubmitted designStatus = "SUBMITTED"
 )
 
+const (
+	codeAdminUnauthorized     = "ADMIN_UNAUTHORIZED"
+	codeCatalogNotFound       = "CATALOG_NOT_FOUND"
+	codeColorNotAllowed       = "COLOR_NOT_ALLOWED"
+	codeDatabaseBusy          = "DATABASE_BUSY"
+	codeDesignLimitReached    = "DESIGN_LIMIT_REACHED"
+	codeDesignNotFound        = "DESIGN_NOT_FOUND"
+	codeDesignUnderReview     = "DESIGN_UNDER_REVIEW"
+	codeDuplicateMaterial     = "DUPLICATE_MATERIAL"
+	codeDuplicateName         = "DUPLICATE_NAME"
+	codeEmailTaken            = "EMAIL_TAKEN"
+	codeInternal              = "INTERNAL_ERROR"
+	codeInvalidBatch          = "INVALID_BATCH"
+	codeInvalidColor          = "INVALID_COLOR"
+	codeInvalidCredentials    = "INVALID_CREDENTIALS"
+	codeInvalidDesignID       = "INVALID_DESIGN_ID"
+	codeInvalidEmail          = "INVALID_EMAIL"
+	codeInvalidFinish         = "INVALID_FINISH"
+	codeInvalidIdempotencyKey = "INVALID_IDEMPOTENCY_KEY"
+	codeInvalidJSON           = "INVALID_JSON"
+	codeInvalidMaterial       = "INVALID_MATERIAL"
+	codeInvalidName           = "INVALID_NAME"
+	codeInvalidNoticeID       = "INVALID_NOTICE_ID"
+	codeInvalidPattern        = "INVALID_PATTERN"
+	codeInvalidQuery          = "INVALID_QUERY_PARAMETER"
+	codeInvalidRequestBody    = "INVALID_REQUEST_BODY"
+	codeInvalidSettingValue   = "INVALID_SETTING_VALUE"
+	codeInvalidShareTarget    = "INVALID_SHARE_TARGET"
+	codeInvalidStatusChange   = "INVALID_STATUS_TRANSITION"
+	codeInvalidTemplate       = "INVALID_TEMPLATE"
+	codeInvalidUserID         = "INVALID_USER_ID"
+	codeMaintenance           = "MAINTENANCE_MODE"
+	codeMaterialNotFound      = "MATERIAL_NOT_FOUND"
+	codeMissingField          = "MISSING_FIELD"
+	codeNotFound              = "NOT_FOUND"
+	codeNoticeNotFound        = "NOTICE_NOT_FOUND"
+	codeRateLimited           = "RATE_LIMITED"
+	codeRequestTooLarge       = "REQUEST_TOO_LARGE"
+	codeSelectionsRequired    = "SELECTIONS_REQUIRED"
+	codeSettingNotFound       = "SETTING_NOT_FOUND"
+	codeSubmissionIncomplete  = "SUBMISSION_INCOMPLETE"
+	codeTemplateNotFound      = "TEMPLATE_NOT_FOUND"
+	codeThumbnailNotFound     = "THUMBNAIL_NOT_FOUND"
+	codeThumbnailTooLarge     = "THUMBNAIL_TOO_LARGE"
+	codeUnauthorized          = "UNAUTHORIZED"
+	codeUnsupportedExport     = "UNSUPPORTED_EXPORT_FORMAT"
+	codeUnsupportedThumbnail  = "UNSUPPORTED_THUMBNAIL_TYPE"
+	codeUserNotFound          = "USER_NOT_FOUND"
+	codeVersionConflict       = "VERSION_CONFLICT"
+	codeWeakPassword          = "WEAK_PASSWORD"
+)
+
+type codedError struct {
+	code    string
+	message string
+}
+
+const designColumns = `d.id, d.user_id, d.name, d.selections_json, d.status, d.rejection_reason, d.submitted_at, d.version, d.created_at, d.updated_at,
+	EXISTS(SELECT 1 FROM design_thumbnails t WHERE t.design_id = d.id)`
+
 var (
-	emailRegex = regexp.MustCompile(`^[^\s@]+@[^\s@]+\.[^\s@]+$`)
-	hexRegex   = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+	emailRegex     = regexp.MustCompile(`^[^\s@]+@[^\s@]+\.[^\s@]+$`)
+	hexRegex       = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+	requestIDRegex = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+	errCorruptDesignData = errors.New("corrupt design data")
+	errDesignLimit       = errors.New("design limit reached")
+	errTrailingJSON      = errors.New("trailing data after JSON value")
+	errDuplicateName     = errors.New("design name already in use")
+	errUnknownSetting    = errors.New("unknown setting")
+	errDatabaseBusy      = errors.New("database is busy")
+	errVersionConflict   = errors.New("design was modified by another request")
+	errIdempotencyKeyUse = errors.New("idempotency key already used")
+	errStatusChanged     = errors.New("design status changed, please retry")
+
+	plusAddressingDomains = map[string]bool{
+		"gmail.com":      true,
+		"googlemail.com": true,
+		"icloud.com":     true,
+		"outlook.com":    true,
+		"hotmail.com":    true,
+		"proton.me":      true,
+		"protonmail.com": true,
+		"fastmail.com":   true,
+	}
+
+	timestampLayouts = []string{
+		time.RFC3339Nano,
+		"2006-01-02T15:04:05",
+		"2006-01-02 15:04:05Z07:00",
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02 15:04:05",
+		"2006-01-02",
+	}
 )
 
 type app struct {
-	adminSecret string
-	db          *sql.DB
-	jwtSecret   []byte
+	adminSecretOn  bool
+	adminSecrets   []string
+	bcryptCost     int
+	catalogETag    string
+	db             *timedDB
+	designEvents   *designEventHub
+	jwtPrivateKey  *rsa.PrivateKey
+	jwtPublicKey   *rsa.PublicKey
+	jwtSecret      []byte
+	maxNameLength  int
+	normalizePlus  bool
+	passwordPolicy passwordPolicy
+	settings       runtimeSettings
+	settingsMu     sync.RWMutex
+	trustedProxies []netip.Prefix
+	uniqueNames    bool
+	writeLimiter   *userRateLimiter
+}
+
+type timedDB struct {
+	*sql.DB
+	slowQueryThreshold time.Duration
+}
+
+type timedTx struct {
+	*sql.Tx
+	db *timedDB
+}
+
+type slowQueryLog struct {
+	DurationMS float64 `json:"durationMs"`
+	Handler    string  `json:"handler"`
+	Level      string  `json:"level"`
+	Message    string  `json:"msg"`
+	Query      string  `json:"query"`
+	RequestID  string  `json:"requestId,omitempty"`
+}
+
+type userRateLimiter struct {
+	lastSweep time.Time
+	limit     int
+	mu        sync.Mutex
+	window    time.Duration
+	windows   map[int64]*rateWindow
+}
+
+type rateWindow struct {
+	count int
+	start time.Time
+}
+
+type runtimeSettings struct {
+	Maintenance          bool `json:"maintenance"`
+	MaxDesignsPerUser    int  `json:"maxDesignsPerUser"`
+	RequireFullSelection bool `json:"requireFullSelection"`
+}
+
+type settingValueRequest struct {
+	Value json.RawMessage `json:"value"`
+}
+
+type designEventHub struct {
+	mu          sync.Mutex
+	subscribers map[int64]map[chan designStatusRecord]struct{}
+}
+
+type corsConfig struct {
+	allowCredentials bool
+	allowedOrigins   map[string]bool
+}
+
+type passwordPolicy struct {
+	minLength    int
+	requireMixed bool
 }
 
 type materialSelection struct {
@@ -52,9 +269,18 @@ type materialSelection struct {
 }
 
 type catalogMaterial struct {
-	Key    string `json:"key"`
-	Name   string `json:"name"`
-	Detail string `json:"detail"`
+	Key               string   `json:"key"`
+	Name              string   `json:"name"`
+	Detail            string   `json:"detail"`
+	DefaultColorHex   string   `json:"defaultColorHex,omitempty"`
+	AllowedColors     []string `json:"allowedColors,omitempty"`
+	AllowedFinishes   []string `json:"allowedFinishes,omitempty"`
+	AllowedPatternIDs []string `json:"allowedPatternIds,omitempty"`
+}
+
+type namedColor struct {
+	Hex  string `json:"hex"`
+	Name string `json:"name"`
 }
 
 type catalogResponse struct {
@@ -63,18 +289,25 @@ type catalogResponse struct {
 	ID                string            `json:"id"`
 	Materials         []catalogMaterial `json:"materials"`
 	Name              string            `json:"name"`
+	NamedColors       []namedColor      `json:"namedColors"`
 }
 
 type designRecord struct {
 	CreatedAt       string                       `json:"createdAt"`
 	DatabaseID      int64                        `json:"-"`
+	Editable        bool                         `json:"editable"`
+	HasThumbnail    bool                         `json:"hasThumbnail"`
 	ID              string                       `json:"id"`
 	Materials       map[string]materialSelection `json:"selections"`
 	Name            string                       `json:"name"`
+	OwnerEmail      *string                      `json:"ownerEmail,omitempty"`
 	RejectionReason *string                      `json:"rejectionReason,omitempty"`
 	Status          designStatus                 `json:"status"`
+	SubmittedAt     *string                      `json:"submittedAt,omitempty"`
 	UpdatedAt       string                       `json:"updatedAt"`
 	UserID          int64                        `json:"-"`
+	Version         int64                        `json:"version"`
+	Warnings        []string                     `json:"warnings,omitempty"`
 }
 
 type adminSubmissionRecord struct {
@@ -84,9 +317,151 @@ type adminSubmissionRecord struct {
 	Name            string                       `json:"name"`
 	RejectionReason *string                      `json:"rejectionReason,omitempty"`
 	Status          designStatus                 `json:"status"`
+	SubmittedAt     *string                      `json:"submittedAt,omitempty"`
 	UpdatedAt       string                       `json:"updatedAt"`
 	UserEmail       string                       `json:"userEmail"`
 	UserID          string                       `json:"userId"`
+	Version         int64                        `json:"version"`
+}
+
+type listDesignsResponse struct {
+	Designs    []designRecord `json:"designs"`
+	NextCursor *string        `json:"nextCursor,omitempty"`
+	PrevCursor *string        `json:"prevCursor,omitempty"`
+	Skipped    int            `json:"skipped,omitempty"`
+}
+
+type corruptDesignRecord struct {
+	Error     string `json:"error"`
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	UpdatedAt string `json:"updatedAt"`
+	UserID    string `json:"userId"`
+}
+
+type designStatusRecord struct {
+	RejectionReason *string      `json:"rejectionReason,omitempty"`
+	Status          designStatus `json:"status"`
+	UpdatedAt       string       `json:"updatedAt"`
+}
+
+type catalogDefaultsResponse struct {
+	CatalogID  string                       `json:"catalogId"`
+	Selections map[string]materialSelection `json:"selections"`
+}
+
+type editorResponse struct {
+	Catalog    catalogResponse              `json:"catalog"`
+	Defaulted  []string                     `json:"defaulted"`
+	Design     designRecord                 `json:"design"`
+	Selections map[string]materialSelection `json:"selections"`
+}
+
+type submitCheckResponse struct {
+	Problems []string `json:"problems"`
+	Ready    bool     `json:"ready"`
+	Warnings []string `json:"warnings"`
+}
+
+type recentDesignRecord struct {
+	designRecord
+	ViewedAt string `json:"viewedAt"`
+}
+
+type recentDesignsResponse struct {
+	Designs []recentDesignRecord `json:"designs"`
+}
+
+type rejectionRecord struct {
+	ID              string `json:"id"`
+	Name            string `json:"name"`
+	RejectedAt      string `json:"rejectedAt"`
+	RejectionReason string `json:"rejectionReason"`
+	UpdatedAt       string `json:"updatedAt"`
+}
+
+type rejectionsResponse struct {
+	Rejections []rejectionRecord `json:"rejections"`
+}
+
+type designSummaryResponse struct {
+	Counts           map[designStatus]int `json:"counts"`
+	LatestDesignID   *string              `json:"latestDesignId"`
+	LatestDesignName *string              `json:"latestDesignName"`
+	Total            int                  `json:"total"`
+	UnreadRejections int                  `json:"unreadRejections"`
+}
+
+type userInsightsResponse struct {
+	DesignCount     int           `json:"designCount"`
+	FavoriteColor   *optionCount  `json:"favoriteColor"`
+	FavoriteFinish  *optionCount  `json:"favoriteFinish"`
+	FavoritePattern *optionCount  `json:"favoritePattern"`
+	TopColors       []optionCount `json:"topColors"`
+	TopFinishes     []optionCount `json:"topFinishes"`
+	TopPatterns     []optionCount `json:"topPatterns"`
+}
+
+type adminSubmissionsResponse struct {
+	Designs []adminSubmissionRecord `json:"designs"`
+	Limit   *int                    `json:"limit,omitempty"`
+	Offset  int                     `json:"offset"`
+	Total   int                     `json:"total"`
+}
+
+type optionCount struct {
+	Count int    `json:"count"`
+	Value string `json:"value"`
+}
+
+type finishUsageResponse struct {
+	DesignCount    int           `json:"designCount"`
+	Finishes       []optionCount `json:"finishes"`
+	SelectionCount int           `json:"selectionCount"`
+	Status         designStatus  `json:"status,omitempty"`
+}
+
+type turnaroundBucket struct {
+	Approved       int     `json:"approved"`
+	AverageSeconds float64 `json:"averageSeconds"`
+	Count          int     `json:"count"`
+	MedianSeconds  float64 `json:"medianSeconds"`
+	Period         string  `json:"period,omitempty"`
+	Rejected       int     `json:"rejected"`
+}
+
+type turnaroundResponse struct {
+	Buckets []turnaroundBucket `json:"buckets"`
+	GroupBy string             `json:"groupBy"`
+	Overall turnaroundBucket   `json:"overall"`
+}
+
+type materialUsageRecord struct {
+	Colors      []optionCount `json:"colors"`
+	DesignCount int           `json:"designCount"`
+	Finishes    []optionCount `json:"finishes"`
+	Key         string        `json:"key"`
+	Name        string        `json:"name"`
+	Patterns    []optionCount `json:"patterns"`
+}
+
+type adminUserRecord struct {
+	CreatedAt       string  `json:"createdAt"`
+	Email           string  `json:"email"`
+	FailedLogins24h int     `json:"failedLogins24h"`
+	ID              string  `json:"id"`
+	IsAdmin         bool    `json:"isAdmin"`
+	LastFailedLogin *string `json:"lastFailedLoginAt,omitempty"`
+	LastLoginAt     *string `json:"lastLoginAt,omitempty"`
+	SignupIP        *string `json:"signupIp,omitempty"`
+	SignupUserAgent *string `json:"signupUserAgent,omitempty"`
+}
+
+type adminUsersResponse struct {
+	Limit  *int              `json:"limit,omitempty"`
+	Offset int               `json:"offset"`
+	Total  int               `json:"total"`
+	Users  []adminUserRecord `json:"users"`
 }
 
 type registerRequest struct {
@@ -102,16 +477,104 @@ type loginRequest struct {
 type designUpsertRequest struct {
 	Name       string                       `json:"name"`
 	Selections map[string]materialSelection `json:"selections"`
+	Version    *int64                       `json:"version"`
+}
+
+type compareDesignsRequest struct {
+	LeftID  string `json:"leftId"`
+	RightID string `json:"rightId"`
+}
+
+type materialDiff struct {
+	ChangedFields []string           `json:"changedFields"`
+	Key           string             `json:"key"`
+	Left          *materialSelection `json:"left"`
+	Right         *materialSelection `json:"right"`
+}
+
+type selectionChangeRecord struct {
+	ChangedAt     string             `json:"changedAt"`
+	ChangedFields []string           `json:"changedFields"`
+	Key           string             `json:"key"`
+	New           *materialSelection `json:"new"`
+	Old           *materialSelection `json:"old"`
+	Version       int64              `json:"version"`
+}
+
+type versionResponse struct {
+	BuildTime string `json:"buildTime"`
+	Commit    string `json:"commit"`
+	GoVersion string `json:"goVersion"`
+	Version   string `json:"version"`
+}
+
+type changelogResponse struct {
+	Changes []selectionChangeRecord `json:"changes"`
+}
+
+type changeEmailRequest struct {
+	NewEmail string `json:"newEmail"`
+	Password string `json:"password"`
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+type transferDesignRequest struct {
+	TargetEmail string `json:"targetEmail"`
+}
+
+type shareDesignRequest struct {
+	Email string `json:"email"`
+}
+
+type sharedDesignRecord struct {
+	designRecord
+	IsOwner  bool   `json:"isOwner"`
+	SharedAt string `json:"sharedAt"`
+}
+
+type sharedDesignsResponse struct {
+	Designs []sharedDesignRecord `json:"designs"`
 }
 
 type rejectRequest struct {
 	Reason string `json:"reason"`
 }
 
+type noticeCreateRequest struct {
+	Active    *bool   `json:"active"`
+	ExpiresAt *string `json:"expiresAt"`
+	Message   string  `json:"message"`
+}
+
+type noticeRecord struct {
+	Active    bool    `json:"active"`
+	CreatedAt string  `json:"createdAt"`
+	ExpiresAt *string `json:"expiresAt,omitempty"`
+	ID        string  `json:"id"`
+	Message   string  `json:"message"`
+}
+
 type userRecord struct {
-	Email        string
-	ID           int64
-	PasswordHash string
+	Email               string
+	ID                  int64
+	IsAdmin             bool
+	LastLoginAt         sql.NullString
+	PasswordHash        string
+	TokensInvalidBefore sql.NullString
+}
+
+type designTemplate struct {
+	ID         string                       `json:"id"`
+	Name       string                       `json:"name"`
+	Selections map[string]materialSelection `json:"selections"`
+}
+
+type templatesResponse struct {
+	Templates []designTemplate `json:"templates"`
 }
 
 type authClaims struct {
@@ -119,48 +582,114 @@ type authClaims struct {
 	jwt.RegisteredClaims
 }
 
+var designTemplates = []designTemplate{
+	{
+		ID:   "midnight-stealth",
+		Name: "Midnight Stealth",
+		Selections: map[string]materialSelection{
+			"material_1": {ColorHex: "#191C22", Finish: "MATTE", PatternID: "NONE"},
+			"material_3": {ColorHex: "#1A2330", Finish: "GLOSS", PatternID: "NONE"},
+			"material_5": {ColorHex: "#1C212A", Finish: "MATTE", PatternID: "NONE"},
+			"material_6": {ColorHex: "#242D38", Finish: "MATTE", PatternID: "NONE"},
+			"material_7": {ColorHex: "#2E343E", Finish: "MATTE", PatternID: "NONE"},
+			"material_8": {ColorHex: "#0C0D10", Finish: "MATTE", PatternID: "NONE"},
+			"material_9": {ColorHex: "#0B0B0C", Finish: "MATTE", PatternID: "NONE"},
+		},
+	},
+	{
+		ID:   "pearl-classic",
+		Name: "Pearl Classic",
+		Selections: map[string]materialSelection{
+			"material_1": {ColorHex: "#5C5E62", Finish: "GLOSS", PatternID: "NONE"},
+			"material_3": {ColorHex: "#1A2330", Finish: "GLOSS", PatternID: "NONE"},
+			"material_5": {ColorHex: "#1C212A", Finish: "GLOSS", PatternID: "NONE"},
+			"material_6": {ColorHex: "#3E4145", Finish: "MATTE", PatternID: "NONE"},
+			"material_7": {ColorHex: "#A9ABAE", Finish: "GLOSS", PatternID: "NONE"},
+			"material_8": {ColorHex: "#141619", Finish: "MATTE", PatternID: "NONE"},
+			"material_9": {ColorHex: "#F2F2EE", Finish: "GLOSS", PatternID: "NONE"},
+		},
+	},
+	{
+		ID:   "ultra-red",
+		Name: "Ultra Red",
+		Selections: map[string]materialSelection{
+			"material_1": {ColorHex: "#8D1723", Finish: "MATTE", PatternID: "NONE"},
+			"material_3": {ColorHex: "#1A2330", Finish: "GLOSS", PatternID: "NONE"},
+			"material_5": {ColorHex: "#0B0B0C", Finish: "GLOSS", PatternID: "NONE"},
+			"material_6": {ColorHex: "#242D38", Finish: "MATTE", PatternID: "NONE"},
+			"material_7": {ColorHex: "#3B4656", Finish: "GLOSS", PatternID: "PATTERN_1"},
+			"material_8": {ColorHex: "#141619", Finish: "MATTE", PatternID: "NONE"},
+			"material_9": {ColorHex: "#A3161C", Finish: "GLOSS", PatternID: "NONE"},
+		},
+	},
+}
+
 var defaultCatalog = catalogResponse{
 	ID:   "tesla-cybertruck-low-poly",
 	Name: "Tesla Cybertruck Low Poly",
 	Materials: []catalogMaterial{
 		{
-			Key:    "material_1",
-			Name:   "Hooks, Hitch & Mud Guards",
-			Detail: "Tow hitch cover, front hooks, and tire splash guards",
+			Key:             "material_1",
+			Name:            "Hooks, Hitch & Mud Guards",
+			Detail:          "Tow hitch cover, front hooks, and tire splash guards",
+			DefaultColorHex: "#8D1723",
 		},
 		{
-			Key:    "material_3",
-			Name:   "Glass Set",
-			Detail: "Windshield, roof glass, and door glass",
+			Key:               "material_3",
+			Name:              "Glass Set",
+			Detail:            "Windshield, roof glass, and door glass",
+			DefaultColorHex:   "#1A2330",
+			AllowedPatternIDs: []string{"NONE"},
 		},
 		{
-			Key:    "material_5",
-			Name:   "Window & Door Frames",
-			Detail: "Trim and surrounding frame pieces",
+			Key:             "material_5",
+			Name:            "Window & Door Frames",
+			Detail:          "Trim and surrounding frame pieces",
+			DefaultColorHex: "#1C212A",
 		},
 		{
-			Key:    "material_6",
-			Name:   "Cargo Bed",
-			Detail: "Rear bed panel and inner bed walls",
+			Key:             "material_6",
+			Name:            "Cargo Bed",
+			Detail:          "Rear bed panel and inner bed walls",
+			DefaultColorHex: "#242D38",
 		},
 		{
-			Key:    "material_7",
-			Name:   "Wheel Covers",
-			Detail: "Wheel cover face and trims",
+			Key:             "material_7",
+			Name:            "Wheel Covers",
+			Detail:          "Wheel cover face and trims",
+			DefaultColorHex: "#3B4656",
 		},
 		{
-			Key:    "material_8",
-			Name:   "Tires",
-			Detail: "Rubber tire material",
+			Key:             "material_8",
+			Name:            "Tires",
+			Detail:          "Rubber tire material",
+			DefaultColorHex: "#141619",
+			AllowedColors:   []string{"#0C0D10", "#111317", "#141619", "#191C22", "#2E343E"},
 		},
 		{
-			Key:    "material_9",
-			Name:   "Body Paint",
-			Detail: "Main Tesla body panels",
+			Key:             "material_9",
+			Name:            "Body Paint",
+			Detail:          "Main Tesla body panels",
+			DefaultColorHex: "#111317",
 		},
 	},
 	AllowedFinishes:   []string{"GLOSS", "MATTE"},
 	AllowedPatternIDs: []string{"NONE", "PATTERN_1", "PATTERN_2", "PATTERN_3"},
+	NamedColors: []namedColor{
+		{Name: "DEEP_BLUE_METALLIC", Hex: "#1F3A5F"},
+		{Name: "MIDNIGHT_SILVER", Hex: "#5C5E62"},
+		{Name: "PEARL_WHITE", Hex: "#F2F2EE"},
+		{Name: "QUICKSILVER", Hex: "#A9ABAE"},
+		{Name: "SOLID_BLACK", Hex: "#0B0B0C"},
+		{Name: "STEALTH_GREY", Hex: "#3E4145"},
+		{Name: "ULTRA_RED", Hex: "#A3161C"},
+	},
+}
+
+// Sub-second iat lets a token minted right after a revoke pass the strict
+// issued-after check while tokens from the revoke's own second still fail.
+func init() {
+	jwt.TimePrecision = time.Microsecond
 }
 
 func main() {
@@ -169,990 +698,6154 @@ func main() {
 		dbPath = "./design_your_tesla.db"
 	}
 
-	db, err := sql.Open("sqlite3", dbPath)
+	db, err := sql.Open("sqlite3", sqliteDSN(dbPath))
 	if err != nil {
 		log.Fatalf("open db: %v", err)
 	}
 	defer db.Close()
 
-	if err := initSchema(db); err != nil {
-		log.Fatalf("init schema: %v", err)
+	maxOpenConns := 10
+	if raw := strings.TrimSpace(os.Getenv("DB_MAX_OPEN_CONNS")); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			log.Fatalf("DB_MAX_OPEN_CONNS must be a positive integer")
+		}
+		maxOpenConns = parsed
 	}
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		jwtSecret = defaultJWTSecret
+	maxIdleConns := 5
+	if raw := strings.TrimSpace(os.Getenv("DB_MAX_IDLE_CONNS")); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 0 {
+			log.Fatalf("DB_MAX_IDLE_CONNS must be a non-negative integer")
+		}
+		maxIdleConns = parsed
 	}
 
-	adminSecret := os.Getenv("ADMIN_SECRET")
-	if adminSecret == "" {
-		adminSecret = defaultAdminSecret
+	connMaxLifetime := 30 * time.Minute
+	if raw := strings.TrimSpace(os.Getenv("DB_CONN_MAX_LIFETIME")); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed < 0 {
+			log.Fatalf("DB_CONN_MAX_LIFETIME must be a non-negative duration")
+		}
+		connMaxLifetime = parsed
 	}
 
-	application := &app{
-		adminSecret: adminSecret,
-		db:          db,
-		jwtSecret:   []byte(jwtSecret),
+	db.SetMaxOpenConns(maxOpenConns)
+	db.SetMaxIdleConns(min(maxIdleConns, maxOpenConns))
+	db.SetConnMaxLifetime(connMaxLifetime)
+
+	if err := verifyForeignKeys(db); err != nil {
+		log.Fatalf("verify foreign keys: %v", err)
 	}
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("GET /health", application.handleHealth)
-	mux.HandleFunc("POST /auth/register", application.handleRegister)
-	mux.HandleFunc("POST /auth/login", application.handleLogin)
-	mux.HandleFunc("GET /me", application.requireAuth(application.handleMe))
-	mux.HandleFunc("GET /catalog/model", application.handleCatalog)
-	mux.HandleFunc("POST /designs", application.requireAuth(application.handleCreateDesign))
-	mux.HandleFunc("GET /designs", application.requireAuth(application.handleListDesigns))
-	mux.HandleFunc("GET /designs/{id}", application.requireAuth(application.handleGetDesign))
-	mux.HandleFunc("PUT /designs/{id}", application.requireAuth(application.handleUpdateDesign))
-	mux.HandleFunc("POST /designs/{id}/submit", application.requireAuth(application.handleSubmitDesign))
-	mux.HandleFunc(
-		"GET /admin/submissions",
-		application.requireAdminSecret(application.handleAdminListSubmissions),
-	)
-	mux.HandleFunc(
-		"POST /admin/designs/{id}/approve",
-		application.requireAdminSecret(application.handleAdminApproveDesign),
-	)
-	mux.HandleFunc(
-		"POST /admin/designs/{id}/reject",
-		application.requireAdminSecret(application.handleAdminRejectDesign),
-	)
+	if err := initSchema(db); err != nil {
+		log.Fatalf("init schema: %v", err)
+	}
 
-	port := strings.TrimSpace(os.Getenv("PORT"))
-	if port == "" {
-		port = "8080"
+	jwtSecret, err := secretFromEnv("JWT_SECRET")
+	if err != nil {
+		log.Fatalf("read JWT_SECRET_FILE: %v", err)
+	}
+	if jwtSecret == "" {
+		jwtSecret = defaultJWTSecret
 	}
 
-	addr := ":" + port
-	log.Printf("backend listening on http://localhost%s", addr)
+	jwtPrivateKey, jwtPublicKey, err := loadRSAKeys(
+		strings.TrimSpace(os.Getenv("JWT_PRIVATE_KEY")),
+		strings.TrimSpace(os.Getenv("JWT_PUBLIC_KEY")),
+	)
+	if err != nil {
+		log.Fatalf("load jwt keys: %v", err)
+	}
 
-	server := &http.Server{
-		Addr:              addr,
-		Handler:           withCORS(mux),
-		ReadHeaderTimeout: 10 * time.Second,
+	adminSecret, err := secretFromEnv("ADMIN_SECRET")
+	if err != nil {
+		log.Fatalf("read ADMIN_SECRET_FILE: %v", err)
+	}
+	adminSecrets := make([]string, 0)
+	if adminSecret != "" {
+		adminSecrets = append(adminSecrets, adminSecret)
+	}
+	for _, secret := range strings.Split(os.Getenv("ADMIN_SECRETS"), ",") {
+		if secret = strings.TrimSpace(secret); secret != "" && !slices.Contains(adminSecrets, secret) {
+			adminSecrets = append(adminSecrets, secret)
+		}
+	}
+	if len(adminSecrets) == 0 {
+		adminSecrets = append(adminSecrets, defaultAdminSecret)
 	}
 
-	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-		log.Fatal(err)
+	adminSecretOn := true
+	if raw := strings.TrimSpace(os.Getenv("ADMIN_SECRET_ENABLED")); raw != "" {
+		enabled, err := strconv.ParseBool(raw)
+		if err != nil {
+			log.Fatalf("ADMIN_SECRET_ENABLED must be a boolean")
+		}
+		adminSecretOn = enabled
 	}
-}
 
-func initSchema(db *sql.DB) error {
-	ddl := `
-PRAGMA foreign_keys = ON;
+	production := false
+	if raw := strings.TrimSpace(os.Getenv("PRODUCTION")); raw != "" {
+		enabled, err := strconv.ParseBool(raw)
+		if err != nil {
+			log.Fatalf("PRODUCTION must be a boolean")
+		}
+		production = enabled
+	}
 
-CREATE TABLE IF NOT EXISTS users (
-  id INTEGER PRIMARY KEY AUTOINCREMENT,
-  email TEXT NOT NULL UNIQUE,
-  password_hash TEXT NOT NULL,
-  created_at TEXT NOT NULL
-);
+	insecureDefaults := make([]string, 0, 2)
+	if jwtPrivateKey == nil && jwtSecret == defaultJWTSecret {
+		insecureDefaults = append(insecureDefaults, "JWT_SECRET")
+	}
+	if adminSecretOn && slices.Contains(adminSecrets, defaultAdminSecret) {
+		insecureDefaults = append(insecureDefaults, "ADMIN_SECRET")
+	}
+	if len(insecureDefaults) > 0 {
+		if production {
+			log.Fatalf("refusing to start with PRODUCTION=true: built-in development default in use for %s", strings.Join(insecureDefaults, ", "))
+		}
+		log.Printf("WARNING: built-in development default in use for %s; set real secrets before deploying", strings.Join(insecureDefaults, ", "))
+	}
 
-CREATE TABLE IF NOT EXISTS designs (
-  id INTEGER PRIMARY KEY AUTOINCREMENT,
-  user_id INTEGER NOT NULL,
-  name TEXT NOT NULL,
-  selections_json TEXT NOT NULL,
-  status TEXT NOT NULL DEFAULT 'DRAFT',
-  rejection_reason TEXT,
-  created_at TEXT NOT NULL,
-  updated_at TEXT NOT NULL,
-  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
-);
+	adminEmails := map[string]bool{}
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		email = strings.TrimSpace(strings.ToLower(email))
+		if email != "" {
+			adminEmails[email] = true
+		}
+	}
+	if err := promoteAdminEmails(db, adminEmails); err != nil {
+		log.Fatalf("promote admin emails: %v", err)
+	}
 
-CREATE INDEX IF NOT EXISTS idx_designs_user_id ON designs(user_id);
-`
+	policy := passwordPolicy{minLength: defaultPasswordMin}
+	if raw := strings.TrimSpace(os.Getenv("PASSWORD_MIN_LENGTH")); raw != "" {
+		minLength, err := strconv.Atoi(raw)
+		if err != nil || minLength <= 0 {
+			log.Fatalf("PASSWORD_MIN_LENGTH must be a positive integer")
+		}
+		policy.minLength = minLength
+	}
+	if raw := strings.TrimSpace(os.Getenv("PASSWORD_REQUIRE_MIXED")); raw != "" {
+		requireMixed, err := strconv.ParseBool(raw)
+		if err != nil {
+			log.Fatalf("PASSWORD_REQUIRE_MIXED must be a boolean")
+		}
+		policy.requireMixed = requireMixed
+	}
 
-	if _, err := db.Exec(ddl); err != nil {
-		return err
+	if catalogPath := strings.TrimSpace(os.Getenv("CATALOG_PATH")); catalogPath != "" {
+		catalog, err := loadCatalog(catalogPath)
+		if err != nil {
+			log.Printf("warning: using built-in catalog, unable to load %s: %v", catalogPath, err)
+		} else {
+			defaultCatalog = catalog
+			log.Printf("loaded catalog %q from %s", catalog.ID, catalogPath)
+		}
 	}
 
-	if err := ensureDesignsColumns(db); err != nil {
-		return err
+	if err := validateCatalog(defaultCatalog); err != nil {
+		log.Fatalf("invalid catalog: %v", err)
 	}
 
-	_, err := db.Exec(`UPDATE designs SET status = ? WHERE status IS NULL OR status = ''`, string(statusDraft))
+	catalogETag, err := computeETag(defaultCatalog)
 	if err != nil {
-		return err
+		log.Fatalf("compute catalog etag: %v", err)
 	}
 
-	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_designs_status ON designs(status)`)
-	return err
-}
-
-func ensureDesignsColumns(db *sql.DB) error {
-	statusExists, err := columnExists(db, "designs", "status")
-	if err != nil {
-		return err
+	uniqueNames := false
+	if raw := strings.TrimSpace(os.Getenv("UNIQUE_DESIGN_NAMES")); raw != "" {
+		enabled, err := strconv.ParseBool(raw)
+		if err != nil {
+			log.Fatalf("UNIQUE_DESIGN_NAMES must be a boolean")
+		}
+		uniqueNames = enabled
 	}
-	if !statusExists {
-		if _, err := db.Exec(`ALTER TABLE designs ADD COLUMN status TEXT NOT NULL DEFAULT 'DRAFT'`); err != nil {
-			return err
+	if err := syncDesignNameIndex(db, uniqueNames); err != nil {
+		log.Fatalf("sync design name index: %v", err)
+	}
+
+	maxNameLength := 120
+	if raw := strings.TrimSpace(os.Getenv("MAX_DESIGN_NAME_LENGTH")); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			log.Fatalf("MAX_DESIGN_NAME_LENGTH must be a positive integer")
 		}
+		maxNameLength = parsed
 	}
 
-	reasonExists, err := columnExists(db, "designs", "rejection_reason")
-	if err != nil {
-		return err
+	bcryptCost := bcrypt.DefaultCost
+	if raw := strings.TrimSpace(os.Getenv("BCRYPT_COST")); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < bcrypt.MinCost || parsed > bcrypt.MaxCost {
+			log.Fatalf("BCRYPT_COST must be an integer between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		bcryptCost = parsed
 	}
-	if !reasonExists {
-		if _, err := db.Exec(`ALTER TABLE designs ADD COLUMN rejection_reason TEXT`); err != nil {
-			return err
+
+	normalizePlus := false
+	if raw := strings.TrimSpace(os.Getenv("NORMALIZE_PLUS_ADDRESSING")); raw != "" {
+		enabled, err := strconv.ParseBool(raw)
+		if err != nil {
+			log.Fatalf("NORMALIZE_PLUS_ADDRESSING must be a boolean")
 		}
+		normalizePlus = enabled
 	}
 
-	return nil
-}
+	maxDesigns := 0
+	if raw := strings.TrimSpace(os.Getenv("MAX_DESIGNS_PER_USER")); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 0 {
+			log.Fatalf("MAX_DESIGNS_PER_USER must be a non-negative integer")
+		}
+		maxDesigns = parsed
+	}
 
-func columnExists(db *sql.DB, tableName, columnName string) (bool, error) {
-	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", tableName))
-	if err != nil {
-		return false, err
+	var writeLimiter *userRateLimiter
+	if raw := strings.TrimSpace(os.Getenv("USER_WRITE_RATE_LIMIT")); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 0 {
+			log.Fatalf("USER_WRITE_RATE_LIMIT must be a non-negative integer")
+		}
+		window := time.Minute
+		if raw := strings.TrimSpace(os.Getenv("USER_WRITE_RATE_WINDOW")); raw != "" {
+			parsed, err := time.ParseDuration(raw)
+			if err != nil || parsed <= 0 {
+				log.Fatalf("USER_WRITE_RATE_WINDOW must be a positive duration")
+			}
+			window = parsed
+		}
+		if limit > 0 {
+			writeLimiter = newUserRateLimiter(limit, window)
+		}
 	}
-	defer rows.Close()
 
+	trustedProxies := make([]netip.Prefix, 0)
+	for _, entry := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(entry)
+			if addrErr != nil {
+				log.Fatalf("TRUSTED_PROXIES entry %q must be an IP address or CIDR", entry)
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+		trustedProxies = append(trustedProxies, prefix.Masked())
+	}
+
+	var slowQueryThreshold time.Duration
+	if raw := strings.TrimSpace(os.Getenv("SLOW_QUERY_MS")); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 0 {
+			log.Fatalf("SLOW_QUERY_MS must be a non-negative integer")
+		}
+		slowQueryThreshold = time.Duration(parsed) * time.Millisecond
+	}
+
+	application := &app{
+		adminSecretOn:  adminSecretOn,
+		adminSecrets:   adminSecrets,
+		bcryptCost:     bcryptCost,
+		catalogETag:    catalogETag,
+		db:             &timedDB{DB: db, slowQueryThreshold: slowQueryThreshold},
+		designEvents:   newDesignEventHub(),
+		jwtPrivateKey:  jwtPrivateKey,
+		jwtPublicKey:   jwtPublicKey,
+		jwtSecret:      []byte(jwtSecret),
+		settings:       runtimeSettings{MaxDesignsPerUser: maxDesigns},
+		maxNameLength:  maxNameLength,
+		normalizePlus:  normalizePlus,
+		passwordPolicy: policy,
+		trustedProxies: trustedProxies,
+		uniqueNames:    uniqueNames,
+		writeLimiter:   writeLimiter,
+	}
+
+	if err := application.loadSettings(context.Background()); err != nil {
+		log.Fatalf("load settings: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", application.handleHealth)
+	mux.HandleFunc("GET /version", application.handleVersion)
+	mux.HandleFunc("POST /auth/register", application.handleRegister)
+	mux.HandleFunc("POST /auth/login", application.handleLogin)
+	mux.HandleFunc("POST /auth/logout", application.handleLogout)
+	mux.HandleFunc("POST /auth/change-email", application.requireAuth(application.handleChangeEmail))
+	mux.HandleFunc("GET /me", application.requireAuth(application.handleMe))
+	mux.HandleFunc("GET /me/recent", application.requireAuth(application.handleRecentDesigns))
+	mux.HandleFunc("GET /me/shared", application.requireAuth(application.handleSharedDesigns))
+	mux.HandleFunc("GET /me/rejections", application.requireAuth(application.handleListRejections))
+	mux.HandleFunc("GET /me/designs/summary", application.requireAuth(application.handleDesignSummary))
+	mux.HandleFunc("GET /me/insights", application.requireAuth(application.handleUserInsights))
+	mux.HandleFunc("POST /me/password", application.requireAuth(application.handleChangePassword))
+	mux.HandleFunc("POST /me/purge-rejected", application.requireAuth(application.handlePurgeRejected))
+	mux.HandleFunc("GET /catalog/model", application.handleCatalog)
+	// A literal GET /catalog/model/{id}/defaults would conflict with GET /catalog/model/materials/{key}
+	// in ServeMux, so the defaults route matches any trailing segment and checks it itself.
+	mux.HandleFunc("GET /catalog/model/{id}/{resource}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("resource") != "defaults" {
+			writeError(w, http.StatusNotFound, codeNotFound, "not found")
+			return
+		}
+		application.handleCatalogDefaults(w, r.WithContext(context.WithValue(r.Context(), handlerKey, "GET /catalog/model/{id}/defaults")))
+	})
+	mux.HandleFunc("GET /catalog/model/materials/{key}", application.handleCatalogMaterial)
+	mux.HandleFunc("POST /designs", application.requireAuth(application.limitWrites(application.handleCreateDesign)))
+	mux.HandleFunc("GET /designs", application.requireAuth(application.handleListDesigns))
+	mux.HandleFunc("POST /designs/batch", application.requireAuth(application.limitWrites(application.handleBatchCreateDesigns)))
+	mux.HandleFunc("POST /designs/import", application.requireAuth(application.limitWrites(application.handleImportDesign)))
+	mux.HandleFunc("GET /designs/{id}/selections.json", application.requireAuth(application.handleDownloadSelections))
+	mux.HandleFunc("POST /designs/compare", application.requireAuth(application.handleCompareDesigns))
+	mux.HandleFunc("GET /designs/{id}", application.requireAuth(application.handleGetDesign))
+	mux.HandleFunc("GET /designs/{id}/status", application.requireAuth(application.handleGetDesignStatus))
+	mux.HandleFunc("GET /designs/{id}/changelog", application.requireAuth(application.handleDesignChangelog))
+	mux.HandleFunc("GET /designs/{id}/events", application.requireAuth(application.handleDesignEvents))
+	mux.HandleFunc("GET /designs/{id}/editor", application.requireAuth(application.handleDesignEditor))
+	mux.HandleFunc("GET /designs/{id}/export", application.requireAuth(application.handleExportDesign))
+	mux.HandleFunc("GET /designs/{id}/palette", application.requireAuth(application.handleDesignPalette))
+	mux.HandleFunc("PUT /designs/{id}", application.requireAuth(application.limitWrites(application.handleUpdateDesign)))
+	mux.HandleFunc("PATCH /designs/{id}/autosave", application.requireAuth(application.limitWrites(application.handleAutosaveDesign)))
+	mux.HandleFunc("GET /designs/{id}/submit-check", application.requireAuth(application.handleSubmitCheck))
+	// POST /designs/{id}/submit and friends share one pattern; separate patterns would conflict
+	// with POST /designs/from-template/{templateId} in ServeMux.
+	designActions := map[string]http.HandlerFunc{
+		"shares":    application.requireAuth(application.handleShareDesign),
+		"submit":    application.requireAuth(application.limitWrites(application.handleSubmitDesign)),
+		"thumbnail": application.requireAuth(application.handleUploadThumbnail),
+		"withdraw":  application.requireAuth(application.handleWithdrawDesign),
+	}
+	mux.HandleFunc("POST /designs/{id}/{action}", func(w http.ResponseWriter, r *http.Request) {
+		action := r.PathValue("action")
+		handler, ok := designActions[action]
+		if !ok {
+			writeError(w, http.StatusNotFound, codeNotFound, "not found")
+			return
+		}
+		handler(w, r.WithContext(context.WithValue(r.Context(), handlerKey, "POST /designs/{id}/"+action)))
+	})
+	mux.HandleFunc(
+		"POST /designs/from-template/{templateId}",
+		application.requireAuth(application.limitWrites(application.handleCreateFromTemplate)),
+	)
+	mux.HandleFunc("GET /designs/{id}/thumbnail", application.requireAuth(application.handleGetThumbnail))
+	mux.HandleFunc("GET /templates", application.handleListTemplates)
+	mux.HandleFunc("GET /notices/active", application.handleActiveNotices)
+	mux.HandleFunc(
+		"GET /admin/submissions",
+		application.requireAdmin(application.handleAdminListSubmissions),
+	)
+	mux.HandleFunc(
+		"GET /admin/export",
+		application.requireAdmin(application.handleAdminExport),
+	)
+	mux.HandleFunc(
+		"GET /admin/submissions/count",
+		application.requireAdmin(application.handleAdminCountSubmissions),
+	)
+	mux.HandleFunc(
+		"GET /admin/designs/corrupt",
+		application.requireAdmin(application.handleAdminListCorruptDesigns),
+	)
+	mux.HandleFunc(
+		"GET /admin/designs/{id}",
+		application.requireAdmin(application.handleAdminGetDesign),
+	)
+	mux.HandleFunc(
+		"POST /admin/designs/{id}/transfer",
+		application.requireAdmin(application.handleAdminTransferDesign),
+	)
+	mux.HandleFunc(
+		"POST /admin/designs/{id}/approve",
+		application.requireAdmin(application.handleAdminApproveDesign),
+	)
+	mux.HandleFunc(
+		"POST /admin/designs/{id}/reject",
+		application.requireAdmin(application.handleAdminRejectDesign),
+	)
+	mux.HandleFunc(
+		"DELETE /admin/designs/{id}/reject",
+		application.requireAdmin(application.handleAdminUndoRejectDesign),
+	)
+	mux.HandleFunc(
+		"GET /admin/users",
+		application.requireAdmin(application.handleAdminListUsers),
+	)
+	mux.HandleFunc(
+		"POST /admin/users/{id}/revoke-tokens",
+		application.requireAdmin(application.handleAdminRevokeTokens),
+	)
+	mux.HandleFunc(
+		"GET /admin/analytics/materials",
+		application.requireAdmin(application.handleAdminMaterialAnalytics),
+	)
+	mux.HandleFunc(
+		"GET /admin/analytics/finishes",
+		application.requireAdmin(application.handleAdminFinishAnalytics),
+	)
+	mux.HandleFunc(
+		"GET /admin/analytics/turnaround",
+		application.requireAdmin(application.handleAdminTurnaroundAnalytics),
+	)
+	mux.HandleFunc(
+		"GET /admin/settings",
+		application.requireAdmin(application.handleAdminGetSettings),
+	)
+	mux.HandleFunc(
+		"PUT /admin/settings/{key}",
+		application.requireAdmin(application.handleAdminPutSetting),
+	)
+	mux.HandleFunc(
+		"POST /admin/notices",
+		application.requireAdmin(application.handleAdminCreateNotice),
+	)
+	mux.HandleFunc(
+		"DELETE /admin/notices/{id}",
+		application.requireAdmin(application.handleAdminDeactivateNotice),
+	)
+
+	if raw := strings.TrimSpace(os.Getenv("DRAFT_TTL_DAYS")); raw != "" {
+		days, err := strconv.Atoi(raw)
+		if err != nil || days <= 0 {
+			log.Fatalf("DRAFT_TTL_DAYS must be a positive integer")
+		}
+		go application.runDraftCleanup(time.Duration(days) * 24 * time.Hour)
+	}
+
+	port := strings.TrimSpace(os.Getenv("PORT"))
+	if port == "" {
+		port = "8080"
+	}
+	host := strings.TrimSpace(os.Getenv("HOST"))
+
+	cors := corsConfig{allowedOrigins: map[string]bool{}}
+	for _, origin := range strings.Split(os.Getenv("CORS_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			cors.allowedOrigins[origin] = true
+		}
+	}
+	if raw := strings.TrimSpace(os.Getenv("CORS_ALLOW_CREDENTIALS")); raw != "" {
+		enabled, err := strconv.ParseBool(raw)
+		if err != nil {
+			log.Fatalf("CORS_ALLOW_CREDENTIALS must be a boolean")
+		}
+		cors.allowCredentials = enabled
+	}
+	if cors.allowCredentials && len(cors.allowedOrigins) == 0 {
+		log.Fatalf("CORS_ALLOW_CREDENTIALS requires CORS_ALLOWED_ORIGINS")
+	}
+
+	readTimeout := 15 * time.Second
+	writeTimeout := 30 * time.Second
+	idleTimeout := 120 * time.Second
+	for name, target := range map[string]*time.Duration{
+		"HTTP_READ_TIMEOUT":  &readTimeout,
+		"HTTP_WRITE_TIMEOUT": &writeTimeout,
+		"HTTP_IDLE_TIMEOUT":  &idleTimeout,
+	} {
+		if raw := strings.TrimSpace(os.Getenv(name)); raw != "" {
+			parsed, err := time.ParseDuration(raw)
+			if err != nil || parsed <= 0 {
+				log.Fatalf("%s must be a positive duration", name)
+			}
+			*target = parsed
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("ENABLE_PPROF")); raw != "" {
+		enabled, err := strconv.ParseBool(raw)
+		if err != nil {
+			log.Fatalf("ENABLE_PPROF must be a boolean")
+		}
+		if enabled {
+			mux.HandleFunc("GET /debug/pprof/", application.requireAdmin(pprof.Index))
+			mux.HandleFunc("GET /debug/pprof/cmdline", application.requireAdmin(pprof.Cmdline))
+			mux.HandleFunc("GET /debug/pprof/profile", application.requireAdmin(capPprofSeconds(writeTimeout, 30, pprof.Profile)))
+			mux.HandleFunc("GET /debug/pprof/symbol", application.requireAdmin(pprof.Symbol))
+			mux.HandleFunc("POST /debug/pprof/symbol", application.requireAdmin(pprof.Symbol))
+			mux.HandleFunc("GET /debug/pprof/trace", application.requireAdmin(capPprofSeconds(writeTimeout, 1, pprof.Trace)))
+			log.Printf("pprof endpoints enabled under /debug/pprof/ (admin only)")
+		}
+	}
+
+	tlsCertFile := strings.TrimSpace(os.Getenv("TLS_CERT_FILE"))
+	tlsKeyFile := strings.TrimSpace(os.Getenv("TLS_KEY_FILE"))
+	if (tlsCertFile == "") != (tlsKeyFile == "") {
+		log.Fatalf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	scheme := "http"
+	if tlsCertFile != "" {
+		for name, path := range map[string]string{"TLS_CERT_FILE": tlsCertFile, "TLS_KEY_FILE": tlsKeyFile} {
+			if _, err := os.Stat(path); err != nil {
+				log.Fatalf("%s: %v", name, err)
+			}
+		}
+		scheme = "https"
+	} else {
+		log.Printf("TLS_CERT_FILE/TLS_KEY_FILE not set, serving plain HTTP")
+	}
+
+	addr := net.JoinHostPort(host, port)
+	displayHost := host
+	if displayHost == "" {
+		displayHost = "0.0.0.0"
+	}
+	log.Printf(
+		"backend listening on %s://%s (read timeout %s, write timeout %s, idle timeout %s)",
+		scheme,
+		net.JoinHostPort(displayHost, port),
+		readTimeout,
+		writeTimeout,
+		idleTimeout,
+	)
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           withRequestID(withHandlerName(mux, withCORS(mux, cors, withGzip(mux)))),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+
+	if scheme == "https" {
+		err = server.ListenAndServeTLS(tlsCertFile, tlsKeyFile)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
+
+func loadCatalog(path string) (catalogResponse, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return catalogResponse{}, err
+	}
+	defer file.Close()
+
+	var catalog catalogResponse
+	if err := decodeJSONReader(file, &catalog); err != nil {
+		return catalogResponse{}, fmt.Errorf("parse catalog: %w", err)
+	}
+	if err := validateCatalog(catalog); err != nil {
+		return catalogResponse{}, err
+	}
+	return catalog, nil
+}
+
+func validateCatalog(catalog catalogResponse) error {
+	if strings.TrimSpace(catalog.ID) == "" || strings.TrimSpace(catalog.Name) == "" {
+		return errors.New("catalog id and name are required")
+	}
+	if len(catalog.Materials) == 0 {
+		return errors.New("catalog must include at least one material")
+	}
+	if len(catalog.AllowedFinishes) == 0 {
+		return errors.New("catalog allowedFinishes must not be empty")
+	}
+	if len(catalog.AllowedPatternIDs) == 0 {
+		return errors.New("catalog allowedPatternIds must not be empty")
+	}
+
+	seen := map[string]bool{}
+	for _, material := range catalog.Materials {
+		if strings.TrimSpace(material.Key) == "" {
+			return errors.New("catalog material key is required")
+		}
+		if seen[material.Key] {
+			return fmt.Errorf("catalog material key %q is duplicated", material.Key)
+		}
+		seen[material.Key] = true
+
+		for _, color := range material.AllowedColors {
+			if !hexRegex.MatchString(color) {
+				return fmt.Errorf("material %q has invalid allowed color %q", material.Key, color)
+			}
+		}
+		if material.DefaultColorHex != "" {
+			if !hexRegex.MatchString(material.DefaultColorHex) {
+				return fmt.Errorf("material %q has invalid default color %q", material.Key, material.DefaultColorHex)
+			}
+			if len(material.AllowedColors) > 0 && !containsFold(material.AllowedColors, material.DefaultColorHex) {
+				return fmt.Errorf("material %q default color %q is not an allowed color", material.Key, material.DefaultColorHex)
+			}
+		}
+	}
+
+	for _, named := range catalog.NamedColors {
+		if strings.TrimSpace(named.Name) == "" {
+			return errors.New("catalog named color name is required")
+		}
+		if !hexRegex.MatchString(named.Hex) {
+			return fmt.Errorf("named color %q has invalid hex %q", named.Name, named.Hex)
+		}
+	}
+
+	return nil
+}
+
+func sqliteDSN(dbPath string) string {
+	separator := "?"
+	if strings.Contains(dbPath, "?") {
+		separator = "&"
+	}
+	return dbPath + separator + "_busy_timeout=5000&_foreign_keys=on&_txlock=immediate"
+}
+
+func secretFromEnv(name string) (string, error) {
+	path := strings.TrimSpace(os.Getenv(name + "_FILE"))
+	if path == "" {
+		return os.Getenv(name), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	secret := strings.TrimRight(string(data), "\r\n")
+	if secret == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return secret, nil
+}
+
+func verifyForeignKeys(db *sql.DB) error {
+	var enabled bool
+	if err := db.QueryRow(`PRAGMA foreign_keys`).Scan(&enabled); err != nil {
+		return err
+	}
+	if !enabled {
+		return errors.New("foreign key enforcement is off; remove _foreign_keys=off from DB_PATH")
+	}
+	return nil
+}
+
+func loadRSAKeys(privateKeyPath, publicKeyPath string) (*rsa.PrivateKey, *rsa.PublicKey, error) {
+	if privateKeyPath == "" && publicKeyPath == "" {
+		return nil, nil, nil
+	}
+	if privateKeyPath == "" || publicKeyPath == "" {
+		return nil, nil, errors.New("JWT_PRIVATE_KEY and JWT_PUBLIC_KEY must be set together")
+	}
+
+	privatePEM, err := os.ReadFile(privateKeyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(privatePEM)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse private key: %w", err)
+	}
+
+	publicPEM, err := os.ReadFile(publicKeyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	publicKey, err := jwt.ParseRSAPublicKeyFromPEM(publicPEM)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse public key: %w", err)
+	}
+
+	return privateKey, publicKey, nil
+}
+
+func initSchema(db *sql.DB) error {
+	ddl := `
+PRAGMA journal_mode = WAL;
+
+CREATE TABLE IF NOT EXISTS users (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  email TEXT NOT NULL UNIQUE,
+  password_hash TEXT NOT NULL,
+  is_admin INTEGER NOT NULL DEFAULT 0,
+  signup_ip TEXT,
+  signup_user_agent TEXT,
+  last_login_at TEXT,
+  normalized_email TEXT,
+  tokens_invalid_before TEXT,
+  created_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS designs (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL,
+  name TEXT NOT NULL,
+  name_key TEXT,
+  selections_json TEXT NOT NULL,
+  status TEXT NOT NULL DEFAULT 'DRAFT',
+  rejection_reason TEXT,
+  submitted_at TEXT,
+  rejected_at TEXT,
+  rejection_seen_at TEXT,
+  version INTEGER NOT NULL DEFAULT 1,
+  created_at TEXT NOT NULL,
+  updated_at TEXT NOT NULL,
+  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_designs_user_id ON designs(user_id);
+
+CREATE TABLE IF NOT EXISTS design_thumbnails (
+  design_id INTEGER PRIMARY KEY,
+  content_type TEXT NOT NULL,
+  data BLOB NOT NULL,
+  updated_at TEXT NOT NULL,
+  FOREIGN KEY(design_id) REFERENCES designs(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  user_id INTEGER NOT NULL,
+  idem_key TEXT NOT NULL,
+  design_id INTEGER NOT NULL,
+  created_at TEXT NOT NULL,
+  PRIMARY KEY(user_id, idem_key),
+  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY(design_id) REFERENCES designs(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_keys(created_at);
+
+CREATE TABLE IF NOT EXISTS admin_audit_log (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  action TEXT NOT NULL,
+  design_id INTEGER,
+  details TEXT NOT NULL,
+  submitted_at TEXT,
+  created_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_admin_audit_log_action ON admin_audit_log(action, created_at);
+
+CREATE TABLE IF NOT EXISTS notices (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  message TEXT NOT NULL,
+  active INTEGER NOT NULL DEFAULT 1,
+  expires_at TEXT,
+  created_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS design_views (
+  user_id INTEGER NOT NULL,
+  design_id INTEGER NOT NULL,
+  viewed_at TEXT NOT NULL,
+  PRIMARY KEY(user_id, design_id),
+  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY(design_id) REFERENCES designs(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_design_views_recent ON design_views(user_id, viewed_at);
+
+CREATE TABLE IF NOT EXISTS shared_with (
+  design_id INTEGER NOT NULL,
+  email TEXT NOT NULL,
+  shared_at TEXT NOT NULL,
+  PRIMARY KEY(design_id, email),
+  FOREIGN KEY(design_id) REFERENCES designs(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_shared_with_email ON shared_with(email);
+
+CREATE TABLE IF NOT EXISTS selection_changes (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  design_id INTEGER NOT NULL,
+  version INTEGER NOT NULL,
+  material_key TEXT NOT NULL,
+  changed_fields TEXT NOT NULL,
+  old_color_hex TEXT,
+  old_finish TEXT,
+  old_pattern_id TEXT,
+  new_color_hex TEXT,
+  new_finish TEXT,
+  new_pattern_id TEXT,
+  changed_at TEXT NOT NULL,
+  FOREIGN KEY(design_id) REFERENCES designs(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_selection_changes_design ON selection_changes(design_id, id);
+
+CREATE TABLE IF NOT EXISTS settings (
+  key TEXT PRIMARY KEY,
+  value TEXT NOT NULL,
+  updated_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS login_attempts (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  email TEXT NOT NULL,
+  ip TEXT NOT NULL,
+  success INTEGER NOT NULL,
+  created_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempts_email ON login_attempts(email, created_at);
+`
+
+	if _, err := db.Exec(ddl); err != nil {
+		return err
+	}
+
+	if err := ensureDesignsColumns(db); err != nil {
+		return err
+	}
+
+	if err := ensureUsersColumns(db); err != nil {
+		return err
+	}
+
+	submittedAtExists, err := columnExists(db, "admin_audit_log", "submitted_at")
+	if err != nil {
+		return err
+	}
+	if !submittedAtExists {
+		if _, err := db.Exec(`ALTER TABLE admin_audit_log ADD COLUMN submitted_at TEXT`); err != nil {
+			return err
+		}
+	}
+
+	_, err = db.Exec(`UPDATE designs SET status = ? WHERE status IS NULL OR status = ''`, string(statusDraft))
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`UPDATE users SET normalized_email = email WHERE normalized_email IS NULL`)
+	if err != nil {
+		return err
+	}
+
+	for oldKey, newKey := range map[string]string{
+		"max_designs_per_user":   "maxDesignsPerUser",
+		"require_full_selection": "requireFullSelection",
+	} {
+		_, err = db.Exec(`UPDATE OR REPLACE settings SET key = ? WHERE key = ?`, newKey, oldKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_users_normalized_email ON users(normalized_email)`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_designs_status_updated ON designs(status, updated_at)`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`DROP INDEX IF EXISTS idx_designs_status`)
+	return err
+}
+
+func ensureDesignsColumns(db *sql.DB) error {
+	statusExists, err := columnExists(db, "designs", "status")
+	if err != nil {
+		return err
+	}
+	if !statusExists {
+		if _, err := db.Exec(`ALTER TABLE designs ADD COLUMN status TEXT NOT NULL DEFAULT 'DRAFT'`); err != nil {
+			return err
+		}
+	}
+
+	reasonExists, err := columnExists(db, "designs", "rejection_reason")
+	if err != nil {
+		return err
+	}
+	if !reasonExists {
+		if _, err := db.Exec(`ALTER TABLE designs ADD COLUMN rejection_reason TEXT`); err != nil {
+			return err
+		}
+	}
+
+	submittedAtExists, err := columnExists(db, "designs", "submitted_at")
+	if err != nil {
+		return err
+	}
+	if !submittedAtExists {
+		if _, err := db.Exec(`ALTER TABLE designs ADD COLUMN submitted_at TEXT`); err != nil {
+			return err
+		}
+	}
+
+	rejectedAtExists, err := columnExists(db, "designs", "rejected_at")
+	if err != nil {
+		return err
+	}
+	if !rejectedAtExists {
+		if _, err := db.Exec(`ALTER TABLE designs ADD COLUMN rejected_at TEXT`); err != nil {
+			return err
+		}
+		if _, err := db.Exec(`UPDATE designs SET rejected_at = updated_at WHERE status = 'REJECTED'`); err != nil {
+			return err
+		}
+	}
+
+	nameKeyExists, err := columnExists(db, "designs", "name_key")
+	if err != nil {
+		return err
+	}
+	if !nameKeyExists {
+		if _, err := db.Exec(`ALTER TABLE designs ADD COLUMN name_key TEXT`); err != nil {
+			return err
+		}
+		if err := backfillDesignNameKeys(db); err != nil {
+			return err
+		}
+	}
+
+	rejectionSeenAtExists, err := columnExists(db, "designs", "rejection_seen_at")
+	if err != nil {
+		return err
+	}
+	if !rejectionSeenAtExists {
+		if _, err := db.Exec(`ALTER TABLE designs ADD COLUMN rejection_seen_at TEXT`); err != nil {
+			return err
+		}
+		if _, err := db.Exec(`UPDATE designs SET rejection_seen_at = COALESCE(rejected_at, updated_at) WHERE status = 'REJECTED'`); err != nil {
+			return err
+		}
+	}
+
+	versionExists, err := columnExists(db, "designs", "version")
+	if err != nil {
+		return err
+	}
+	if !versionExists {
+		if _, err := db.Exec(`ALTER TABLE designs ADD COLUMN version INTEGER NOT NULL DEFAULT 1`); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func ensureUsersColumns(db *sql.DB) error {
+	isAdminExists, err := columnExists(db, "users", "is_admin")
+	if err != nil {
+		return err
+	}
+	if !isAdminExists {
+		if _, err := db.Exec(`ALTER TABLE users ADD COLUMN is_admin INTEGER NOT NULL DEFAULT 0`); err != nil {
+			return err
+		}
+	}
+
+	for _, column := range []string{"signup_ip", "signup_user_agent", "last_login_at", "normalized_email", "tokens_invalid_before"} {
+		exists, err := columnExists(db, "users", column)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			if _, err := db.Exec(fmt.Sprintf("ALTER TABLE users ADD COLUMN %s TEXT", column)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func backfillDesignNameKeys(db *sql.DB) error {
+	rows, err := db.Query(`SELECT id, name FROM designs`)
+	if err != nil {
+		return err
+	}
+	keys := map[int64]string{}
+	for rows.Next() {
+		var (
+			id   int64
+			name string
+		)
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return err
+		}
+		keys[id] = designNameKey(name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, key := range keys {
+		if _, err := db.Exec(`UPDATE designs SET name_key = ? WHERE id = ?`, key, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func syncDesignNameIndex(db *sql.DB, unique bool) error {
+	if !unique {
+		_, err := db.Exec(`DROP INDEX IF EXISTS idx_designs_user_name_key`)
+		return err
+	}
+
+	_, err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_designs_user_name_key ON designs(user_id, name_key)`)
+	if !isDuplicateNameError(err) {
+		return err
+	}
+
+	var (
+		userID    int64
+		nameKey   string
+		conflicts int
+	)
+	if err := db.QueryRow(
+		`SELECT user_id, name_key, COUNT(*) FROM designs GROUP BY user_id, name_key HAVING COUNT(*) > 1 LIMIT 1`,
+	).Scan(&userID, &nameKey, &conflicts); err != nil {
+		return err
+	}
+	return fmt.Errorf("user %d has %d designs named %q; rename them before enabling unique names", userID, conflicts, nameKey)
+}
+
+func designNameKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+func isDuplicateNameError(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
+
+func promoteAdminEmails(db *sql.DB, adminEmails map[string]bool) error {
+	for email := range adminEmails {
+		if _, err := db.Exec(`UPDATE users SET is_admin = 1 WHERE email = ?`, email); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func columnExists(db *sql.DB, tableName, columnName string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", tableName))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			valueType string
+			notNull   int
+			defaultV  sql.NullString
+			primary   int
+		)
+		if err := rows.Scan(&cid, &name, &valueType, &notNull, &defaultV, &primary); err != nil {
+			return false, err
+		}
+
+		if strings.EqualFold(name, columnName) {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
+
+func (a *app) runDraftCleanup(ttl time.Duration) {
+	ticker := time.NewTicker(draftCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		a.deleteStaleDrafts(ttl)
+		<-ticker.C
+	}
+}
+
+func (a *app) handlePurgeRejected(w http.ResponseWriter, r *http.Request, user userRecord) {
+	tx, err := a.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to purge rejected designs")
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(
+		r.Context(),
+		`DELETE FROM designs WHERE user_id = ? AND status = ?`,
+		user.ID,
+		string(statusRejected),
+	)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to purge rejected designs")
+		return
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to purge rejected designs")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to purge rejected designs")
+		return
+	}
+
+	log.Printf("user %d purged %d rejected designs", user.ID, deleted)
+	writeJSON(w, http.StatusOK, map[string]int64{"deleted": deleted})
+}
+
+func (a *app) deleteStaleDrafts(ttl time.Duration) {
+	cutoff := time.Now().UTC().Add(-ttl).Format(time.RFC3339)
+	ctx := context.WithValue(context.Background(), handlerKey, "draftCleanup")
+	result, err := a.db.ExecContext(
+		ctx,
+		`DELETE FROM designs WHERE status = ? AND updated_at < ?`,
+		string(statusDraft),
+		cutoff,
+	)
+	if err != nil {
+		log.Printf("draft cleanup failed: %v", err)
+		return
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		log.Printf("draft cleanup failed: %v", err)
+		return
+	}
+	log.Printf("draft cleanup removed %d drafts not updated since %s", deleted, cutoff)
+}
+
+func (a *app) handleHealth(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+func (a *app) handleVersion(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, versionResponse{
+		BuildTime: buildTime,
+		Commit:    buildCommit,
+		GoVersion: runtime.Version(),
+		Version:   buildVersion,
+	})
+}
+
+func (a *app) handleCatalog(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("ETag", a.catalogETag)
+	if etagMatches(r.Header.Get("If-None-Match"), a.catalogETag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(w, http.StatusOK, defaultCatalog)
+}
+
+func (a *app) handleCatalogDefaults(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("id") != defaultCatalog.ID {
+		writeError(w, http.StatusNotFound, codeCatalogNotFound, "catalog not found")
+		return
+	}
+
+	w.Header().Set("ETag", a.catalogETag)
+	if etagMatches(r.Header.Get("If-None-Match"), a.catalogETag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	selections := make(map[string]materialSelection, len(defaultCatalog.Materials))
+	for _, material := range defaultCatalog.Materials {
+		selections[material.Key] = material.defaultSelection()
+	}
+
+	writeJSON(w, http.StatusOK, catalogDefaultsResponse{CatalogID: defaultCatalog.ID, Selections: selections})
+}
+
+func (a *app) handleCatalogMaterial(w http.ResponseWriter, r *http.Request) {
+	material, ok := findCatalogMaterial(r.PathValue("key"))
+	if !ok {
+		writeError(w, http.StatusNotFound, codeMaterialNotFound, "material not found")
+		return
+	}
+
+	w.Header().Set("ETag", a.catalogETag)
+	if etagMatches(r.Header.Get("If-None-Match"), a.catalogETag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	material.DefaultColorHex = material.defaultColor()
+	material.AllowedFinishes = material.finishes()
+	material.AllowedPatternIDs = material.patternIDs()
+	writeJSON(w, http.StatusOK, material)
+}
+
+func (a *app) handleRegister(w http.ResponseWriter, r *http.Request) {
+	if a.currentSettings().Maintenance {
+		writeError(w, http.StatusServiceUnavailable, codeMaintenance, "service is in maintenance mode")
+		return
+	}
+
+	var req registerRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	email := strings.TrimSpace(strings.ToLower(req.Email))
+	password := strings.TrimSpace(req.Password)
+	if !emailRegex.MatchString(email) {
+		writeError(w, http.StatusBadRequest, codeInvalidEmail, "email is invalid")
+		return
+	}
+	if err := a.passwordPolicy.validatePassword(password); err != nil {
+		writeError(w, http.StatusBadRequest, codeWeakPassword, err.Error())
+		return
+	}
+
+	normalizedEmail := a.normalizeEmail(email)
+	taken, err := a.normalizedEmailTaken(r.Context(), normalizedEmail, 0)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to register user")
+		return
+	}
+	if taken {
+		writeError(w, http.StatusConflict, codeEmailTaken, "email already registered")
+		return
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), a.bcryptCost)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to hash password")
+		return
+	}
+
+	createdAt := time.Now().UTC().Format(time.RFC3339)
+	result, err := a.db.ExecContext(
+		r.Context(),
+		`INSERT INTO users(email, normalized_email, password_hash, is_admin, signup_ip, signup_user_agent, created_at) VALUES (?, ?, ?, 0, ?, ?, ?)`,
+		email,
+		normalizedEmail,
+		string(passwordHash),
+		a.clientIP(r),
+		r.UserAgent(),
+		createdAt,
+	)
+	if err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "unique") {
+			writeError(w, http.StatusConflict, codeEmailTaken, "email already registered")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to register user")
+		return
+	}
+
+	userID, err := result.LastInsertId()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to register user")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]string{
+		"id":        strconv.FormatInt(userID, 10),
+		"email":     email,
+		"createdAt": createdAt,
+	})
+}
+
+func (a *app) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	email := strings.TrimSpace(strings.ToLower(req.Email))
+	if !emailRegex.MatchString(email) {
+		a.recordLoginAttempt(r, email, false)
+		writeError(w, http.StatusBadRequest, codeInvalidEmail, "email is invalid")
+		return
+	}
+
+	user, err := a.findUserByEmail(r.Context(), email)
+	if err != nil {
+		a.recordLoginAttempt(r, email, false)
+		writeError(w, http.StatusUnauthorized, codeInvalidCredentials, "invalid credentials")
+		return
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)) != nil {
+		a.recordLoginAttempt(r, email, false)
+		writeError(w, http.StatusUnauthorized, codeInvalidCredentials, "invalid credentials")
+		return
+	}
+	a.recordLoginAttempt(r, email, true)
+
+	if cost, err := bcrypt.Cost([]byte(user.PasswordHash)); err == nil && cost < a.bcryptCost {
+		if err := a.rehashPassword(r.Context(), user.ID, req.Password); err != nil {
+			log.Printf("rehash password for user %d: %v", user.ID, err)
+		}
+	}
+
+	token, err := a.signToken(user)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to create token")
+		return
+	}
+
+	_, err = a.db.ExecContext(
+		r.Context(),
+		`UPDATE users SET last_login_at = ? WHERE id = ?`,
+		time.Now().UTC().Format(time.RFC3339),
+		user.ID,
+	)
+	if err != nil {
+		log.Printf("record last login for user %d: %v", user.ID, err)
+	}
+
+	if r.URL.Query().Get("cookie") == "true" || strings.EqualFold(r.Header.Get("X-Auth-Mode"), "cookie") {
+		http.SetCookie(w, &http.Cookie{
+			Name:     authCookieName,
+			Value:    token,
+			Path:     "/",
+			MaxAge:   int(tokenTTL / time.Second),
+			HttpOnly: true,
+			Secure:   true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		writeJSON(w, http.StatusOK, map[string]string{
+			"expiresAt": time.Now().UTC().Add(tokenTTL).Format(time.RFC3339),
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"token": token})
+}
+
+func (a *app) handleLogout(w http.ResponseWriter, _ *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     authCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *app) handleMe(w http.ResponseWriter, _ *http.Request, user userRecord) {
+	payload := map[string]string{
+		"id":    strconv.FormatInt(user.ID, 10),
+		"email": user.Email,
+	}
+	if user.LastLoginAt.Valid {
+		payload["lastLoginAt"] = user.LastLoginAt.String
+	}
+	writeJSON(w, http.StatusOK, payload)
+}
+
+func (a *app) handleUserInsights(w http.ResponseWriter, r *http.Request, user userRecord) {
+	rows, err := a.db.QueryContext(r.Context(), `SELECT selections_json FROM designs WHERE user_id = ?`, user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load insights")
+		return
+	}
+	defer rows.Close()
+
+	designCount := 0
+	colors := map[string]int{}
+	finishes := map[string]int{}
+	patterns := map[string]int{}
+	for rows.Next() {
+		var selectionsJSON string
+		if err := rows.Scan(&selectionsJSON); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "unable to load insights")
+			return
+		}
+
+		selections := map[string]materialSelection{}
+		if err := json.Unmarshal([]byte(selectionsJSON), &selections); err != nil {
+			continue
+		}
+
+		designCount++
+		for _, selection := range selections {
+			colors[strings.ToUpper(selection.ColorHex)]++
+			finishes[selection.Finish]++
+			patterns[selection.PatternID]++
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load insights")
+		return
+	}
+
+	insights := userInsightsResponse{
+		DesignCount: designCount,
+		TopColors:   topOptionCounts(colors, defaultAnalyticsTopN),
+		TopFinishes: topOptionCounts(finishes, defaultAnalyticsTopN),
+		TopPatterns: topOptionCounts(patterns, defaultAnalyticsTopN),
+	}
+	if len(insights.TopColors) > 0 {
+		insights.FavoriteColor = &insights.TopColors[0]
+	}
+	if len(insights.TopFinishes) > 0 {
+		insights.FavoriteFinish = &insights.TopFinishes[0]
+	}
+	if len(insights.TopPatterns) > 0 {
+		insights.FavoritePattern = &insights.TopPatterns[0]
+	}
+
+	writeJSON(w, http.StatusOK, insights)
+}
+
+func (a *app) handleDesignSummary(w http.ResponseWriter, r *http.Request, user userRecord) {
+	summary := designSummaryResponse{
+		Counts: map[designStatus]int{
+			statusApproved:  0,
+			statusDraft:     0,
+			statusRejected:  0,
+			statusSubmitted: 0,
+		},
+	}
+
+	rows, err := a.db.QueryContext(
+		r.Context(),
+		`SELECT status, COUNT(*) FROM designs WHERE user_id = ? GROUP BY status`,
+		user.ID,
+	)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load design summary")
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			statusValue string
+			count       int
+		)
+		if err := rows.Scan(&statusValue, &count); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "unable to load design summary")
+			return
+		}
+		summary.Counts[designStatus(statusValue)] = count
+		summary.Total += count
+	}
+
+	if err := rows.Err(); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load design summary")
+		return
+	}
+
+	err = a.db.QueryRowContext(
+		r.Context(),
+		`SELECT COUNT(*) FROM designs WHERE user_id = ? AND status = ? AND rejection_seen_at IS NULL`,
+		user.ID,
+		string(statusRejected),
+	).Scan(&summary.UnreadRejections)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load design summary")
+		return
+	}
+
+	var (
+		latestID   int64
+		latestName string
+	)
+	err = a.db.QueryRowContext(
+		r.Context(),
+		`SELECT id, name FROM designs WHERE user_id = ? ORDER BY updated_at DESC, id DESC LIMIT 1`,
+		user.ID,
+	).Scan(&latestID, &latestName)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load design summary")
+		return
+	}
+	if err == nil {
+		id := strconv.FormatInt(latestID, 10)
+		summary.LatestDesignID = &id
+		summary.LatestDesignName = &latestName
+	}
+
+	writeJSON(w, http.StatusOK, summary)
+}
+
+func (a *app) handleRecentDesigns(w http.ResponseWriter, r *http.Request, user userRecord) {
+	limit := defaultRecentLimit
+	if raw := strings.TrimSpace(r.URL.Query().Get("limit")); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			writeError(w, http.StatusBadRequest, codeInvalidQuery, "limit must be a positive integer")
+			return
+		}
+		limit = min(parsed, maxRecentLimit)
+	}
+
+	rows, err := a.db.QueryContext(
+		r.Context(),
+		`SELECT `+designColumns+`, v.viewed_at
+		 FROM design_views v
+		 JOIN designs d ON d.id = v.design_id
+		 WHERE v.user_id = ? AND d.user_id = v.user_id
+		 ORDER BY v.viewed_at DESC, d.id DESC
+		 LIMIT ?`,
+		user.ID,
+		limit,
+	)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load recent designs")
+		return
+	}
+	defer rows.Close()
+
+	designs := make([]recentDesignRecord, 0)
+	for rows.Next() {
+		var viewedAt string
+		record, err := scanDesign(rows, &viewedAt)
+		if err != nil {
+			if errors.Is(err, errCorruptDesignData) {
+				writeError(w, http.StatusInternalServerError, codeInternal, "corrupt design data")
+				return
+			}
+			writeError(w, http.StatusInternalServerError, codeInternal, "unable to load recent designs")
+			return
+		}
+		designs = append(designs, recentDesignRecord{designRecord: record, ViewedAt: viewedAt})
+	}
+
+	if err := rows.Err(); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load recent designs")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, recentDesignsResponse{Designs: designs})
+}
+
+func (a *app) handleSharedDesigns(w http.ResponseWriter, r *http.Request, user userRecord) {
+	rows, err := a.db.QueryContext(
+		r.Context(),
+		`SELECT `+designColumns+`, u.email, s.shared_at
+		 FROM shared_with s
+		 JOIN designs d ON d.id = s.design_id
+		 JOIN users u ON u.id = d.user_id
+		 WHERE s.email = ? AND d.user_id != ?
+		 ORDER BY s.shared_at DESC, d.id DESC`,
+		user.Email,
+		user.ID,
+	)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load shared designs")
+		return
+	}
+	defer rows.Close()
+
+	designs := make([]sharedDesignRecord, 0)
+	for rows.Next() {
+		var ownerEmail, sharedAt string
+		record, err := scanDesign(rows, &ownerEmail, &sharedAt)
+		if err != nil {
+			if errors.Is(err, errCorruptDesignData) {
+				writeError(w, http.StatusInternalServerError, codeInternal, "corrupt design data")
+				return
+			}
+			writeError(w, http.StatusInternalServerError, codeInternal, "unable to load shared designs")
+			return
+		}
+		record.OwnerEmail = &ownerEmail
+		designs = append(designs, sharedDesignRecord{designRecord: record, SharedAt: sharedAt})
+	}
+
+	if err := rows.Err(); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load shared designs")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, sharedDesignsResponse{Designs: designs})
+}
+
+func (a *app) handleShareDesign(w http.ResponseWriter, r *http.Request, user userRecord) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, codeInvalidDesignID, "design id is invalid")
+		return
+	}
+
+	var req shareDesignRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	email := strings.TrimSpace(strings.ToLower(req.Email))
+	if !emailRegex.MatchString(email) {
+		writeError(w, http.StatusBadRequest, codeInvalidEmail, "email is invalid")
+		return
+	}
+	if email == user.Email {
+		writeError(w, http.StatusBadRequest, codeInvalidShareTarget, "cannot share a design with yourself")
+		return
+	}
+
+	record, err := a.findDesignByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load design")
+		return
+	}
+	if record.UserID != user.ID {
+		writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+		return
+	}
+
+	_, err = a.db.ExecContext(
+		r.Context(),
+		`INSERT INTO shared_with(design_id, email, shared_at) VALUES (?, ?, ?)
+		 ON CONFLICT(design_id, email) DO NOTHING`,
+		id,
+		email,
+		time.Now().UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to share design")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *app) recordDesignView(userID, designID int64) {
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), handlerKey, "recordDesignView"), 5*time.Second)
+	defer cancel()
+
+	_, err := a.db.ExecContext(
+		ctx,
+		`INSERT INTO design_views(user_id, design_id, viewed_at) VALUES (?, ?, ?)
+		 ON CONFLICT(user_id, design_id) DO UPDATE SET viewed_at = excluded.viewed_at`,
+		userID,
+		designID,
+		time.Now().UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+	)
+	if err != nil {
+		log.Printf("record design view for user %d: %v", userID, err)
+	}
+}
+
+func (a *app) markRejectionSeen(ctx context.Context, designID int64) {
+	_, err := a.db.ExecContext(
+		ctx,
+		`UPDATE designs SET rejection_seen_at = ? WHERE id = ? AND status = ? AND rejection_seen_at IS NULL`,
+		time.Now().UTC().Format(time.RFC3339),
+		designID,
+		string(statusRejected),
+	)
+	if err != nil {
+		log.Printf("mark rejection seen for design %d: %v", designID, err)
+	}
+}
+
+func (a *app) handleListRejections(w http.ResponseWriter, r *http.Request, user userRecord) {
+	rows, err := a.db.QueryContext(
+		r.Context(),
+		`SELECT id, name, COALESCE(rejection_reason, ''), COALESCE(rejected_at, updated_at), updated_at
+		FROM designs WHERE user_id = ? AND status = ?
+		ORDER BY COALESCE(rejected_at, updated_at) DESC, id DESC`,
+		user.ID,
+		string(statusRejected),
+	)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load rejections")
+		return
+	}
+	defer rows.Close()
+
+	rejections := make([]rejectionRecord, 0)
+	for rows.Next() {
+		var (
+			id     int64
+			record rejectionRecord
+		)
+		if err := rows.Scan(&id, &record.Name, &record.RejectionReason, &record.RejectedAt, &record.UpdatedAt); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "unable to load rejections")
+			return
+		}
+		record.ID = strconv.FormatInt(id, 10)
+		if record.RejectedAt, err = normalizeTimestamp(record.RejectedAt); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "corrupt design data")
+			return
+		}
+		if record.UpdatedAt, err = normalizeTimestamp(record.UpdatedAt); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "corrupt design data")
+			return
+		}
+		rejections = append(rejections, record)
+	}
+
+	if err := rows.Err(); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load rejections")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rejectionsResponse{Rejections: rejections})
+}
+
+func (a *app) handleChangeEmail(w http.ResponseWriter, r *http.Request, user userRecord) {
+	var req changeEmailRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	email := strings.TrimSpace(strings.ToLower(req.NewEmail))
+	if !emailRegex.MatchString(email) {
+		writeError(w, http.StatusBadRequest, codeInvalidEmail, "email is invalid")
+		return
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)) != nil {
+		writeError(w, http.StatusUnauthorized, codeInvalidCredentials, "invalid credentials")
+		return
+	}
+
+	normalizedEmail := a.normalizeEmail(email)
+	taken, err := a.normalizedEmailTaken(r.Context(), normalizedEmail, user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to change email")
+		return
+	}
+	if taken {
+		writeError(w, http.StatusConflict, codeEmailTaken, "email already registered")
+		return
+	}
+
+	_, err = a.db.ExecContext(
+		r.Context(),
+		`UPDATE users SET email = ?, normalized_email = ? WHERE id = ?`,
+		email,
+		normalizedEmail,
+		user.ID,
+	)
+	if err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "unique") {
+			writeError(w, http.StatusConflict, codeEmailTaken, "email already registered")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to change email")
+		return
+	}
+
+	user.Email = email
+	token, err := a.signToken(user)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to create token")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"id":    strconv.FormatInt(user.ID, 10),
+		"email": email,
+		"token": token,
+	})
+}
+
+func (a *app) handleChangePassword(w http.ResponseWriter, r *http.Request, user userRecord) {
+	var req changePasswordRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.CurrentPassword)) != nil {
+		writeError(w, http.StatusUnauthorized, codeInvalidCredentials, "current password is incorrect")
+		return
+	}
+
+	password := strings.TrimSpace(req.NewPassword)
+	if err := a.passwordPolicy.validatePassword(password); err != nil {
+		writeError(w, http.StatusBadRequest, codeWeakPassword, err.Error())
+		return
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), a.bcryptCost)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to hash password")
+		return
+	}
+
+	_, err = a.db.ExecContext(
+		r.Context(),
+		`UPDATE users SET password_hash = ? WHERE id = ?`,
+		string(passwordHash),
+		user.ID,
+	)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to change password")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *app) handleCreateDesign(w http.ResponseWriter, r *http.Request, user userRecord) {
+	var req designUpsertRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	idempotencyKey := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+	if len(idempotencyKey) > maxIdempotencyKeyLen {
+		writeError(w, http.StatusBadRequest, codeInvalidIdempotencyKey, "Idempotency-Key is too long")
+		return
+	}
+	if idempotencyKey != "" {
+		existing, found, err := a.findIdempotentDesign(r.Context(), user.ID, idempotencyKey)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "unable to save design")
+			return
+		}
+		if found {
+			w.Header().Set("Idempotent-Replayed", "true")
+			writeJSON(w, http.StatusCreated, existing)
+			return
+		}
+	}
+
+	selections, err := validateSelections(req.Selections)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, errorCode(err, codeInvalidMaterial), err.Error())
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = fmt.Sprintf("Design %d", time.Now().UTC().Unix())
+	}
+	if err := a.validateName(name); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, codeInvalidName, err.Error())
+		return
+	}
+	if err := a.checkDesignName(r.Context(), user.ID, name, 0); err != nil {
+		if errors.Is(err, errDuplicateName) {
+			writeError(w, http.StatusConflict, codeDuplicateName, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to save design")
+		return
+	}
+
+	if err := a.checkDesignLimit(r.Context(), user.ID, 1); err != nil {
+		if errors.Is(err, errDesignLimit) {
+			writeError(w, http.StatusForbidden, codeDesignLimitReached, fmt.Sprintf("design limit of %d reached", a.currentSettings().MaxDesignsPerUser))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to save design")
+		return
+	}
+
+	duplicateID, err := a.findDuplicateDesign(r.Context(), user.ID, selections)
+	if err != nil {
+		log.Printf("check duplicate design for user %d: %v", user.ID, err)
+	}
+
+	var record designRecord
+	err = retryOnBusy(r.Context(), func() error {
+		tx, err := a.db.BeginTx(r.Context(), nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		record, err = insertDesign(r.Context(), tx, user.ID, name, selections, a.currentSettings().MaxDesignsPerUser)
+		if err != nil {
+			return err
+		}
+
+		if idempotencyKey != "" {
+			_, err := tx.ExecContext(
+				r.Context(),
+				`INSERT INTO idempotency_keys(user_id, idem_key, design_id, created_at) VALUES (?, ?, ?, ?)`,
+				user.ID,
+				idempotencyKey,
+				record.DatabaseID,
+				record.CreatedAt,
+			)
+			if err != nil {
+				if strings.Contains(strings.ToLower(err.Error()), "unique") {
+					return errIdempotencyKeyUse
+				}
+				return err
+			}
+		}
+
+		return tx.Commit()
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errIdempotencyKeyUse):
+			existing, found, err := a.findIdempotentDesign(r.Context(), user.ID, idempotencyKey)
+			if err == nil && found {
+				w.Header().Set("Idempotent-Replayed", "true")
+				writeJSON(w, http.StatusCreated, existing)
+				return
+			}
+		case errors.Is(err, errDuplicateName):
+			writeError(w, http.StatusConflict, codeDuplicateName, err.Error())
+			return
+		case errors.Is(err, errDesignLimit):
+			writeError(w, http.StatusForbidden, codeDesignLimitReached, fmt.Sprintf("design limit of %d reached", a.currentSettings().MaxDesignsPerUser))
+			return
+		case errors.Is(err, errDatabaseBusy):
+			writeError(w, http.StatusServiceUnavailable, codeDatabaseBusy, "database is busy, try again")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to save design")
+		return
+	}
+
+	if duplicateID != 0 {
+		w.Header().Set("X-Duplicate-Of", strconv.FormatInt(duplicateID, 10))
+	}
+	record.Warnings = checkSelectionWarnings(selections)
+	writeJSON(w, http.StatusCreated, record)
+}
+
+func (a *app) handleBatchCreateDesigns(w http.ResponseWriter, r *http.Request, user userRecord) {
+	var reqs []designUpsertRequest
+	if err := decodeJSON(r, &reqs); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	if len(reqs) == 0 {
+		writeError(w, http.StatusBadRequest, codeInvalidBatch, "batch must include at least one design")
+		return
+	}
+	if len(reqs) > maxBatchDesigns {
+		writeError(w, http.StatusBadRequest, codeInvalidBatch, fmt.Sprintf("batch must include at most %d designs", maxBatchDesigns))
+		return
+	}
+
+	names := make([]string, len(reqs))
+	selections := make([]map[string]materialSelection, len(reqs))
+	seenNames := map[string]bool{}
+	for i, req := range reqs {
+		validated, err := validateSelections(req.Selections)
+		if err != nil {
+			writeError(w, http.StatusUnprocessableEntity, errorCode(err, codeInvalidMaterial), fmt.Sprintf("designs[%d]: %v", i, err))
+			return
+		}
+		selections[i] = validated
+
+		name := strings.TrimSpace(req.Name)
+		if name == "" {
+			name = fmt.Sprintf("Design %d-%d", time.Now().UTC().Unix(), i+1)
+		}
+		if err := a.validateName(name); err != nil {
+			writeError(w, http.StatusUnprocessableEntity, codeInvalidName, fmt.Sprintf("designs[%d]: %v", i, err))
+			return
+		}
+		if a.uniqueNames && seenNames[strings.ToLower(name)] {
+			writeError(w, http.StatusConflict, codeDuplicateName, fmt.Sprintf("designs[%d]: %v", i, errDuplicateName))
+			return
+		}
+		seenNames[strings.ToLower(name)] = true
+		if err := a.checkDesignName(r.Context(), user.ID, name, 0); err != nil {
+			if errors.Is(err, errDuplicateName) {
+				writeError(w, http.StatusConflict, codeDuplicateName, fmt.Sprintf("designs[%d]: %v", i, err))
+				return
+			}
+			writeError(w, http.StatusInternalServerError, codeInternal, "unable to save designs")
+			return
+		}
+		names[i] = name
+	}
+
+	if err := a.checkDesignLimit(r.Context(), user.ID, len(reqs)); err != nil {
+		if errors.Is(err, errDesignLimit) {
+			writeError(w, http.StatusForbidden, codeDesignLimitReached, fmt.Sprintf("design limit of %d reached", a.currentSettings().MaxDesignsPerUser))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to save designs")
+		return
+	}
+
+	tx, err := a.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to save designs")
+		return
+	}
+	defer tx.Rollback()
+
+	maxDesigns := a.currentSettings().MaxDesignsPerUser
+	records := make([]designRecord, 0, len(reqs))
+	for i := range reqs {
+		record, err := insertDesign(r.Context(), tx, user.ID, names[i], selections[i], maxDesigns)
+		if err != nil {
+			if errors.Is(err, errDuplicateName) {
+				writeError(w, http.StatusConflict, codeDuplicateName, fmt.Sprintf("designs[%d]: %v", i, err))
+				return
+			}
+			if errors.Is(err, errDesignLimit) {
+				writeError(w, http.StatusForbidden, codeDesignLimitReached, fmt.Sprintf("design limit of %d reached", maxDesigns))
+				return
+			}
+			writeError(w, http.StatusInternalServerError, codeInternal, "unable to save designs")
+			return
+		}
+		records = append(records, record)
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to save designs")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, listDesignsResponse{Designs: records})
+}
+
+func (a *app) handleListTemplates(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, templatesResponse{Templates: designTemplates})
+}
+
+func (a *app) handleCreateFromTemplate(w http.ResponseWriter, r *http.Request, user userRecord) {
+	templateID := r.PathValue("templateId")
+	index := slices.IndexFunc(designTemplates, func(t designTemplate) bool { return t.ID == templateID })
+	if index < 0 {
+		writeError(w, http.StatusNotFound, codeTemplateNotFound, "template not found")
+		return
+	}
+	template := designTemplates[index]
+
+	selections, err := validateSelections(template.Selections)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, codeInvalidTemplate, fmt.Sprintf("template %q is not valid for the current catalog: %v", template.ID, err))
+		return
+	}
+
+	name := template.Name
+	if err := a.checkDesignName(r.Context(), user.ID, name, 0); err != nil {
+		if errors.Is(err, errDuplicateName) {
+			name = fmt.Sprintf("%s %d", template.Name, time.Now().UTC().Unix())
+		} else {
+			writeError(w, http.StatusInternalServerError, codeInternal, "unable to save design")
+			return
+		}
+	}
+
+	if err := a.checkDesignLimit(r.Context(), user.ID, 1); err != nil {
+		if errors.Is(err, errDesignLimit) {
+			writeError(w, http.StatusForbidden, codeDesignLimitReached, fmt.Sprintf("design limit of %d reached", a.currentSettings().MaxDesignsPerUser))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to save design")
+		return
+	}
+
+	maxDesigns := a.currentSettings().MaxDesignsPerUser
+	record, err := insertDesign(r.Context(), a.db, user.ID, name, selections, maxDesigns)
+	if err != nil {
+		if errors.Is(err, errDuplicateName) {
+			writeError(w, http.StatusConflict, codeDuplicateName, err.Error())
+			return
+		}
+		if errors.Is(err, errDesignLimit) {
+			writeError(w, http.StatusForbidden, codeDesignLimitReached, fmt.Sprintf("design limit of %d reached", maxDesigns))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to save design")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, record)
+}
+
+func (a *app) handleImportDesign(w http.ResponseWriter, r *http.Request, user userRecord) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportBytes))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeError(w, http.StatusRequestEntityTooLarge, codeRequestTooLarge, "import exceeds 1 MiB")
+			return
+		}
+		writeError(w, http.StatusBadRequest, codeInvalidRequestBody, "unable to read request body")
+		return
+	}
+
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	var req designUpsertRequest
+	if _, wrapped := envelope["selections"]; wrapped {
+		if err := decodeJSONReader(bytes.NewReader(body), &req); err != nil {
+			writeDecodeError(w, err)
+			return
+		}
+	} else if err := decodeJSONReader(bytes.NewReader(body), &req.Selections); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	selections, err := validateSelections(req.Selections)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, errorCode(err, codeInvalidMaterial), err.Error())
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = strings.TrimSpace(r.URL.Query().Get("name"))
+	}
+	if name == "" {
+		name = fmt.Sprintf("Imported Design %d", time.Now().UTC().Unix())
+	}
+	if err := a.validateName(name); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, codeInvalidName, err.Error())
+		return
+	}
+	if err := a.checkDesignName(r.Context(), user.ID, name, 0); err != nil {
+		if errors.Is(err, errDuplicateName) {
+			writeError(w, http.StatusConflict, codeDuplicateName, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to import design")
+		return
+	}
+
+	if err := a.checkDesignLimit(r.Context(), user.ID, 1); err != nil {
+		if errors.Is(err, errDesignLimit) {
+			writeError(w, http.StatusForbidden, codeDesignLimitReached, fmt.Sprintf("design limit of %d reached", a.currentSettings().MaxDesignsPerUser))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to import design")
+		return
+	}
+
+	maxDesigns := a.currentSettings().MaxDesignsPerUser
+	record, err := insertDesign(r.Context(), a.db, user.ID, name, selections, maxDesigns)
+	if err != nil {
+		if errors.Is(err, errDuplicateName) {
+			writeError(w, http.StatusConflict, codeDuplicateName, err.Error())
+			return
+		}
+		if errors.Is(err, errDesignLimit) {
+			writeError(w, http.StatusForbidden, codeDesignLimitReached, fmt.Sprintf("design limit of %d reached", maxDesigns))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to import design")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, record)
+}
+
+func (a *app) handleDownloadSelections(w http.ResponseWriter, r *http.Request, user userRecord) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, codeInvalidDesignID, "design id is invalid")
+		return
+	}
+
+	record, err := a.findDesignByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load design")
+		return
+	}
+
+	if record.UserID != user.ID {
+		writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "design-"+record.ID+"-selections.json"))
+	writeJSON(w, http.StatusOK, record.Materials)
+}
+
+func (a *app) handleDesignPalette(w http.ResponseWriter, r *http.Request, user userRecord) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, codeInvalidDesignID, "design id is invalid")
+		return
+	}
+
+	record, err := a.findDesignByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load design")
+		return
+	}
+
+	if record.UserID != user.ID {
+		writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+		return
+	}
+
+	counts := map[string]int{}
+	for _, selection := range record.Materials {
+		colorHex := strings.ToUpper(strings.TrimSpace(selection.ColorHex))
+		if colorHex == "" {
+			continue
+		}
+		counts[colorHex]++
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"colors": topOptionCounts(counts, len(counts)),
+		"id":     record.ID,
+	})
+}
+
+func (a *app) handleListDesigns(w http.ResponseWriter, r *http.Request, user userRecord) {
+	query := r.URL.Query()
+	if query.Has("offset") {
+		writeError(w, http.StatusBadRequest, codeInvalidQuery, "offset is not supported, page with after/before cursors")
+		return
+	}
+	if query.Has("after") && query.Has("before") {
+		writeError(w, http.StatusBadRequest, codeInvalidQuery, "after and before cannot be combined")
+		return
+	}
+	paged := query.Has("limit") || query.Has("after") || query.Has("before")
+
+	limit, _, err := parsePagination(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidQuery, err.Error())
+		return
+	}
+
+	conditions := []string{"d.user_id = ?"}
+	args := []interface{}{user.ID}
+	rangeConditions, rangeArgs, err := parseTimeRange(query, "d.created_at", "createdAfter", "createdBefore")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidQuery, err.Error())
+		return
+	}
+	conditions = append(conditions, rangeConditions...)
+	args = append(args, rangeArgs...)
+	countStatement := `SELECT COUNT(*) FROM designs d WHERE ` + strings.Join(conditions, " AND ")
+	countArgs := slices.Clone(args)
+
+	order := "DESC"
+	backward := false
+	for _, cursor := range []struct {
+		param    string
+		operator string
+	}{
+		{"after", "<"},
+		{"before", ">"},
+	} {
+		rawCursor := strings.TrimSpace(query.Get(cursor.param))
+		if rawCursor == "" {
+			continue
+		}
+		cursorCreatedAt, cursorID, err := parseDesignCursor(cursor.param, rawCursor)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidQuery, err.Error())
+			return
+		}
+		conditions = append(conditions, "(d.created_at, d.id) "+cursor.operator+" (?, ?)")
+		args = append(args, cursorCreatedAt, cursorID)
+		if cursor.param == "before" {
+			order = "ASC"
+			backward = true
+		}
+	}
+
+	statement := `SELECT ` + designColumns + ` FROM designs d WHERE ` + strings.Join(conditions, " AND ") +
+		` ORDER BY d.created_at ` + order + `, d.id ` + order
+	if paged {
+		statement += ` LIMIT ?`
+		args = append(args, limit+1)
+	}
+
+	rows, err := a.db.QueryContext(r.Context(), statement, args...)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load designs")
+		return
+	}
+	defer rows.Close()
+
+	designs := make([]designRecord, 0)
+	scanned := 0
+	skipped := 0
+	firstCursor := ""
+	lastCursor := ""
+	for rows.Next() {
+		scanned++
+		if paged && scanned > limit {
+			break
+		}
+
+		record, err := scanDesign(rows)
+		if err != nil {
+			if errors.Is(err, errCorruptDesignData) {
+				log.Printf("skipping design %d in list for user %d: %v", record.DatabaseID, user.ID, err)
+				skipped++
+				lastCursor = record.CreatedAt + "," + strconv.FormatInt(record.DatabaseID, 10)
+				if firstCursor == "" {
+					firstCursor = lastCursor
+				}
+				continue
+			}
+			writeError(w, http.StatusInternalServerError, codeInternal, "unable to load designs")
+			return
+		}
+
+		designs = append(designs, record)
+		lastCursor = record.CreatedAt + "," + record.ID
+		if firstCursor == "" {
+			firstCursor = lastCursor
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load designs")
+		return
+	}
+
+	var total int
+	err = a.db.QueryRowContext(r.Context(), countStatement, countArgs...).Scan(&total)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load designs")
+		return
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+	// Pages read with before= come back oldest first; flip them so every page is newest first.
+	hasMore := paged && scanned > limit
+	hasNext, hasPrev := hasMore, strings.TrimSpace(query.Get("after")) != ""
+	if backward {
+		slices.Reverse(designs)
+		firstCursor, lastCursor = lastCursor, firstCursor
+		hasNext, hasPrev = true, hasMore
+	}
+
+	response := listDesignsResponse{Designs: designs, Skipped: skipped}
+	links := make([]string, 0, 2)
+	if hasNext && lastCursor != "" {
+		nextCursor := lastCursor
+		response.NextCursor = &nextCursor
+		links = append(links, pageLink(r, "next", map[string]string{
+			"after":  nextCursor,
+			"before": "",
+			"limit":  strconv.Itoa(limit),
+		}))
+	}
+	if hasPrev && firstCursor != "" {
+		prevCursor := firstCursor
+		response.PrevCursor = &prevCursor
+		links = append(links, pageLink(r, "prev", map[string]string{
+			"after":  "",
+			"before": prevCursor,
+			"limit":  strconv.Itoa(limit),
+		}))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (a *app) handleGetDesign(w http.ResponseWriter, r *http.Request, user userRecord) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, codeInvalidDesignID, "design id is invalid")
+		return
+	}
+
+	includeOwner := false
+	if rawInclude := strings.TrimSpace(r.URL.Query().Get("include")); rawInclude != "" {
+		for _, expansion := range strings.Split(rawInclude, ",") {
+			switch strings.TrimSpace(expansion) {
+			case "owner":
+				includeOwner = true
+			default:
+				writeError(w, http.StatusBadRequest, codeInvalidQuery, "include is invalid")
+				return
+			}
+		}
+	}
+
+	record, err := a.findDesignByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load design")
+		return
+	}
+
+	if record.UserID != user.ID {
+		writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+		return
+	}
+
+	if r.Method != http.MethodHead {
+		go a.recordDesignView(user.ID, record.DatabaseID)
+		if record.Status == statusRejected {
+			a.markRejectionSeen(r.Context(), record.DatabaseID)
+		}
+	}
+
+	if includeOwner {
+		record.OwnerEmail = &user.Email
+	}
+	writeJSON(w, http.StatusOK, record)
+}
+
+func (a *app) handleGetDesignStatus(w http.ResponseWriter, r *http.Request, user userRecord) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, codeInvalidDesignID, "design id is invalid")
+		return
+	}
+
+	var (
+		record          designStatusRecord
+		rejectionReason sql.NullString
+	)
+	err = a.db.QueryRowContext(
+		r.Context(),
+		`SELECT status, rejection_reason, updated_at FROM designs WHERE id = ? AND user_id = ?`,
+		id,
+		user.ID,
+	).Scan(&record.Status, &rejectionReason, &record.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load design")
+		return
+	}
+
+	if record.UpdatedAt, err = normalizeTimestamp(record.UpdatedAt); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "corrupt design data")
+		return
+	}
+	if rejectionReason.Valid {
+		record.RejectionReason = &rejectionReason.String
+	}
+
+	writeJSON(w, http.StatusOK, record)
+}
+
+func (a *app) handleDesignChangelog(w http.ResponseWriter, r *http.Request, user userRecord) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, codeInvalidDesignID, "design id is invalid")
+		return
+	}
+
+	existing, err := a.findDesignByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load design")
+		return
+	}
+	if existing.UserID != user.ID {
+		writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+		return
+	}
+
+	rows, err := a.db.QueryContext(
+		r.Context(),
+		`SELECT version, material_key, changed_fields,
+		        old_color_hex, old_finish, old_pattern_id,
+		        new_color_hex, new_finish, new_pattern_id,
+		        changed_at
+		 FROM selection_changes
+		 WHERE design_id = ?
+		 ORDER BY id DESC`,
+		id,
+	)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load changelog")
+		return
+	}
+	defer rows.Close()
+
+	changes := make([]selectionChangeRecord, 0)
+	for rows.Next() {
+		var (
+			change                          selectionChangeRecord
+			changedFields                   string
+			oldColor, oldFinish, oldPattern sql.NullString
+			newColor, newFinish, newPattern sql.NullString
+		)
+		if err := rows.Scan(
+			&change.Version,
+			&change.Key,
+			&changedFields,
+			&oldColor, &oldFinish, &oldPattern,
+			&newColor, &newFinish, &newPattern,
+			&change.ChangedAt,
+		); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "unable to load changelog")
+			return
+		}
+		if change.ChangedAt, err = normalizeTimestamp(change.ChangedAt); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "corrupt changelog data")
+			return
+		}
+
+		change.ChangedFields = []string{}
+		if changedFields != "" {
+			change.ChangedFields = strings.Split(changedFields, ",")
+		}
+		if oldColor.Valid {
+			change.Old = &materialSelection{ColorHex: oldColor.String, Finish: oldFinish.String, PatternID: oldPattern.String}
+		}
+		if newColor.Valid {
+			change.New = &materialSelection{ColorHex: newColor.String, Finish: newFinish.String, PatternID: newPattern.String}
+		}
+		changes = append(changes, change)
+	}
+	if err := rows.Err(); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load changelog")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, changelogResponse{Changes: changes})
+}
+
+func (a *app) handleDesignEvents(w http.ResponseWriter, r *http.Request, user userRecord) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, codeInvalidDesignID, "design id is invalid")
+		return
+	}
+
+	events, unsubscribe := a.designEvents.subscribe(id)
+	defer unsubscribe()
+
+	record, err := a.findDesignByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load design")
+		return
+	}
+
+	if record.UserID != user.ID {
+		writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+		return
+	}
+
+	controller := http.NewResponseController(w)
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "streaming is not supported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	writeEvent := func(event designStatusRecord) error {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "event: status\ndata: %s\n\n", payload); err != nil {
+			return err
+		}
+		return controller.Flush()
+	}
+
+	if err := writeEvent(designStatusRecord{
+		RejectionReason: record.RejectionReason,
+		Status:          record.Status,
+		UpdatedAt:       record.UpdatedAt,
+	}); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-events:
+			if err := writeEvent(event); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			if err := controller.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (a *app) handleDesignEditor(w http.ResponseWriter, r *http.Request, user userRecord) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, codeInvalidDesignID, "design id is invalid")
+		return
+	}
+
+	record, err := a.findDesignByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+			return
+		}
+		if errors.Is(err, errCorruptDesignData) {
+			writeError(w, http.StatusInternalServerError, codeInternal, "corrupt design data")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load design")
+		return
+	}
+
+	if record.UserID != user.ID {
+		writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+		return
+	}
+
+	selections := make(map[string]materialSelection, len(defaultCatalog.Materials))
+	defaulted := make([]string, 0)
+	for key, value := range record.Materials {
+		selections[key] = value
+	}
+	for _, material := range defaultCatalog.Materials {
+		if _, ok := selections[material.Key]; ok {
+			continue
+		}
+		selections[material.Key] = material.defaultSelection()
+		defaulted = append(defaulted, material.Key)
+	}
+
+	writeJSON(w, http.StatusOK, editorResponse{
+		Catalog:    defaultCatalog,
+		Defaulted:  defaulted,
+		Design:     record,
+		Selections: selections,
+	})
+}
+
+func (a *app) handleCompareDesigns(w http.ResponseWriter, r *http.Request, user userRecord) {
+	var req compareDesignsRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	designs := make([]designRecord, 0, 2)
+	for _, rawID := range []string{req.LeftID, req.RightID} {
+		id, err := strconv.ParseInt(strings.TrimSpace(rawID), 10, 64)
+		if err != nil || id <= 0 {
+			writeError(w, http.StatusBadRequest, codeInvalidDesignID, "design id is invalid")
+			return
+		}
+
+		record, err := a.findDesignByID(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+				return
+			}
+			writeError(w, http.StatusInternalServerError, codeInternal, "unable to load design")
+			return
+		}
+
+		if record.UserID != user.ID {
+			writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+			return
+		}
+		designs = append(designs, record)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"leftId":      designs[0].ID,
+		"rightId":     designs[1].ID,
+		"differences": diffSelections(designs[0].Materials, designs[1].Materials),
+	})
+}
+
+func (a *app) handleExportDesign(w http.ResponseWriter, r *http.Request, user userRecord) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, codeInvalidDesignID, "design id is invalid")
+		return
+	}
+
+	format, ok := negotiateExportFormat(r)
+	if !ok {
+		writeError(w, http.StatusNotAcceptable, codeUnsupportedExport, "export format must be json, csv, or pdf")
+		return
+	}
+
+	record, err := a.findDesignByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load design")
+		return
+	}
+
+	if record.UserID != user.ID {
+		writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+		return
+	}
+
+	filename := fmt.Sprintf("design-%s.%s", record.ID, format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		writer := csv.NewWriter(w)
+		_ = writer.Write([]string{"materialKey", "materialName", "colorHex", "finish", "patternId"})
+		for _, key := range sortedSelectionKeys(record.Materials) {
+			selection := record.Materials[key]
+			_ = writer.Write([]string{key, catalogMaterialName(key), selection.ColorHex, selection.Finish, selection.PatternID})
+		}
+		writer.Flush()
+	case "pdf":
+		data, err := renderDesignPDF(record)
+		if err != nil {
+			w.Header().Del("Content-Disposition")
+			writeError(w, http.StatusInternalServerError, codeInternal, "unable to render design PDF")
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(data)
+	default:
+		writeJSON(w, http.StatusOK, record)
+	}
+}
+
+func (a *app) handleUpdateDesign(w http.ResponseWriter, r *http.Request, user userRecord) {
+	a.saveDesign(w, r, user, false)
+}
+
+func (a *app) handleAutosaveDesign(w http.ResponseWriter, r *http.Request, user userRecord) {
+	a.saveDesign(w, r, user, true)
+}
+
+func (a *app) saveDesign(w http.ResponseWriter, r *http.Request, user userRecord, autosave bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, codeInvalidDesignID, "design id is invalid")
+		return
+	}
+
+	existing, err := a.findDesignByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load design")
+		return
+	}
+
+	if existing.UserID != user.ID {
+		writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+		return
+	}
+	if existing.Status == statusSubmitted {
+		writeError(w, http.StatusConflict, codeDesignUnderReview, "design is under review; withdraw it before editing")
+		return
+	}
+
+	var req designUpsertRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	if req.Version == nil {
+		writeError(w, http.StatusBadRequest, codeMissingField, "version is required")
+		return
+	}
+	if *req.Version != existing.Version {
+		writeError(w, http.StatusConflict, codeVersionConflict, "design was modified by another request")
+		return
+	}
+	version := existing.Version
+
+	selections, err := validateSelections(req.Selections)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, errorCode(err, codeInvalidMaterial), err.Error())
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = existing.Name
+	}
+	if err := a.validateName(name); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, codeInvalidName, err.Error())
+		return
+	}
+	if err := a.checkDesignName(r.Context(), user.ID, name, existing.DatabaseID); err != nil {
+		if errors.Is(err, errDuplicateName) {
+			writeError(w, http.StatusConflict, codeDuplicateName, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to update design")
+		return
+	}
+
+	selectionsJSON, err := marshalSelections(selections)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to encode design selections")
+		return
+	}
+
+	if autosave && name == existing.Name {
+		storedJSON, err := marshalSelections(existing.Materials)
+		if err == nil && bytes.Equal(storedJSON, selectionsJSON) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	updatedAt := time.Now().UTC().Format(time.RFC3339)
+	err = retryOnBusy(r.Context(), func() error {
+		tx, err := a.db.BeginTx(r.Context(), nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		result, err := tx.ExecContext(
+			r.Context(),
+			`UPDATE designs SET name = ?, name_key = ?, selections_json = ?, status = ?, rejection_reason = NULL, submitted_at = NULL, version = version + 1, updated_at = ? WHERE id = ? AND user_id = ? AND version = ?`,
+			name,
+			designNameKey(name),
+			string(selectionsJSON),
+			string(statusDraft),
+			updatedAt,
+			id,
+			user.ID,
+			version,
+		)
+		if err != nil {
+			if isDuplicateNameError(err) {
+				return errDuplicateName
+			}
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return errVersionConflict
+		}
+
+		for _, diff := range diffSelections(existing.Materials, selections) {
+			if err := recordSelectionChange(r.Context(), tx, id, version+1, diff, updatedAt); err != nil {
+				return err
+			}
+		}
+
+		return tx.Commit()
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errVersionConflict):
+			writeError(w, http.StatusConflict, codeVersionConflict, err.Error())
+		case errors.Is(err, errDuplicateName):
+			writeError(w, http.StatusConflict, codeDuplicateName, err.Error())
+		case errors.Is(err, errDatabaseBusy):
+			writeError(w, http.StatusServiceUnavailable, codeDatabaseBusy, "database is busy, try again")
+		default:
+			writeError(w, http.StatusInternalServerError, codeInternal, "unable to update design")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, designRecord{
+		CreatedAt:    existing.CreatedAt,
+		ID:           strconv.FormatInt(id, 10),
+		Materials:    selections,
+		Name:         name,
+		Status:       statusDraft,
+		Editable:     statusDraft.editable(),
+		UpdatedAt:    updatedAt,
+		UserID:       user.ID,
+		DatabaseID:   id,
+		Version:      version + 1,
+		HasThumbnail: existing.HasThumbnail,
+		Warnings:     checkSelectionWarnings(selections),
+	})
+}
+
+func (a *app) handleSubmitDesign(w http.ResponseWriter, r *http.Request, user userRecord) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, codeInvalidDesignID, "design id is invalid")
+		return
+	}
+
+	tx, err := a.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to submit design")
+		return
+	}
+	defer tx.Rollback()
+
+	record, err := scanDesign(tx.QueryRowContext(
+		r.Context(),
+		`SELECT `+designColumns+` FROM designs d WHERE d.id = ?`,
+		id,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load design")
+		return
+	}
+
+	if record.UserID != user.ID {
+		writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+		return
+	}
+
+	if record.Status == statusSubmitted {
+		writeError(w, http.StatusConflict, codeInvalidStatusChange, "design is already submitted")
+		return
+	}
+	if record.Status == statusApproved {
+		writeError(w, http.StatusConflict, codeInvalidStatusChange, "approved designs cannot be re-submitted")
+		return
+	}
+
+	if problems := a.submissionProblems(record.Materials); len(problems) > 0 {
+		writeError(w, http.StatusUnprocessableEntity, codeSubmissionIncomplete, problems[0])
+		return
+	}
+
+	affected, err := updateDesignStatus(r.Context(), tx, id, statusSubmitted, nil, record.Status)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to submit design")
+		return
+	}
+	if affected == 0 {
+		writeError(w, http.StatusConflict, codeVersionConflict, "design status changed, please retry")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to submit design")
+		return
+	}
+
+	updatedRecord, err := a.findDesignByID(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load design")
+		return
+	}
+	a.designEvents.publish(updatedRecord)
+
+	writeJSON(w, http.StatusOK, updatedRecord)
+}
+
+func (a *app) handleWithdrawDesign(w http.ResponseWriter, r *http.Request, user userRecord) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, codeInvalidDesignID, "design id is invalid")
+		return
+	}
+
+	record, err := a.findDesignByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load design")
+		return
+	}
+
+	if record.UserID != user.ID {
+		writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+		return
+	}
+	if record.Status != statusSubmitted {
+		writeError(w, http.StatusConflict, codeInvalidStatusChange, "only submitted designs can be withdrawn")
+		return
+	}
+
+	affected, err := updateDesignStatus(r.Context(), a.db, id, statusDraft, nil, statusSubmitted)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to withdraw design")
+		return
+	}
+	if affected == 0 {
+		writeError(w, http.StatusConflict, codeVersionConflict, "design status changed, please retry")
+		return
+	}
+	log.Printf("user %d withdrew design %d from review", user.ID, id)
+
+	updatedRecord, err := a.findDesignByID(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load design")
+		return
+	}
+	a.designEvents.publish(updatedRecord)
+
+	writeJSON(w, http.StatusOK, updatedRecord)
+}
+
+func (a *app) handleSubmitCheck(w http.ResponseWriter, r *http.Request, user userRecord) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, codeInvalidDesignID, "design id is invalid")
+		return
+	}
+
+	record, err := a.findDesignByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+			return
+		}
+		if errors.Is(err, errCorruptDesignData) {
+			writeError(w, http.StatusInternalServerError, codeInternal, "corrupt design data")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load design")
+		return
+	}
+
+	if record.UserID != user.ID {
+		writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+		return
+	}
+
+	problems := make([]string, 0)
+	switch record.Status {
+	case statusSubmitted:
+		problems = append(problems, "design is already submitted")
+	case statusApproved:
+		problems = append(problems, "approved designs cannot be re-submitted")
+	}
+	problems = append(problems, a.submissionProblems(record.Materials)...)
+
+	writeJSON(w, http.StatusOK, submitCheckResponse{
+		Problems: problems,
+		Ready:    len(problems) == 0,
+		Warnings: submissionWarnings(record.Materials),
+	})
+}
+
+func (a *app) handleUploadThumbnail(w http.ResponseWriter, r *http.Request, user userRecord) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, codeInvalidDesignID, "design id is invalid")
+		return
+	}
+
+	record, err := a.findDesignByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load design")
+		return
+	}
+
+	if record.UserID != user.ID {
+		writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxThumbnailBytes+(64<<10))
+	file, _, err := r.FormFile("thumbnail")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeError(w, http.StatusRequestEntityTooLarge, codeThumbnailTooLarge, "thumbnail exceeds 2 MiB")
+			return
+		}
+		writeError(w, http.StatusBadRequest, codeMissingField, "thumbnail file is required")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxThumbnailBytes+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidRequestBody, "unable to read thumbnail")
+		return
+	}
+	if len(data) > maxThumbnailBytes {
+		writeError(w, http.StatusRequestEntityTooLarge, codeThumbnailTooLarge, "thumbnail exceeds 2 MiB")
+		return
+	}
+	if len(data) == 0 {
+		writeError(w, http.StatusBadRequest, codeMissingField, "thumbnail file is required")
+		return
+	}
+
+	contentType := http.DetectContentType(data)
+	if contentType != "image/png" && contentType != "image/webp" {
+		writeError(w, http.StatusUnsupportedMediaType, codeUnsupportedThumbnail, "thumbnail must be a PNG or WebP image")
+		return
+	}
+
+	_, err = a.db.ExecContext(
+		r.Context(),
+		`INSERT INTO design_thumbnails(design_id, content_type, data, updated_at) VALUES (?, ?, ?, ?)
+		 ON CONFLICT(design_id) DO UPDATE SET content_type = excluded.content_type, data = excluded.data, updated_at = excluded.updated_at`,
+		id,
+		contentType,
+		data,
+		time.Now().UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to save thumbnail")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *app) handleGetThumbnail(w http.ResponseWriter, r *http.Request, user userRecord) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, codeInvalidDesignID, "design id is invalid")
+		return
+	}
+
+	var (
+		contentType string
+		data        []byte
+	)
+	err = a.db.QueryRowContext(
+		r.Context(),
+		`SELECT t.content_type, t.data
+		 FROM design_thumbnails t
+		 JOIN designs d ON d.id = t.design_id
+		 WHERE t.design_id = ? AND d.user_id = ?`,
+		id,
+		user.ID,
+	).Scan(&contentType, &data)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, codeThumbnailNotFound, "thumbnail not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load thumbnail")
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+func (a *app) handleAdminListSubmissions(w http.ResponseWriter, r *http.Request) {
+	status := statusSubmitted
+	if rawStatus := strings.TrimSpace(r.URL.Query().Get("status")); rawStatus != "" {
+		parsed, ok := parseDesignStatus(rawStatus)
+		if !ok {
+			writeError(w, http.StatusBadRequest, codeInvalidQuery, "status is invalid")
+			return
+		}
+		status = parsed
+	}
+
+	paged := r.URL.Query().Has("limit") || r.URL.Query().Has("offset")
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidQuery, err.Error())
+		return
+	}
+	queryLimit := -1
+	if paged {
+		queryLimit = limit
+	}
+
+	conditions := []string{"d.status = ?"}
+	args := []interface{}{string(status)}
+	rangeConditions, rangeArgs, err := parseTimeRange(r.URL.Query(), "d.updated_at", "updatedAfter", "updatedBefore")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidQuery, err.Error())
+		return
+	}
+	conditions = append(conditions, rangeConditions...)
+	args = append(args, rangeArgs...)
+	where := strings.Join(conditions, " AND ")
+
+	var total int
+	err = a.db.QueryRowContext(r.Context(), `SELECT COUNT(*) FROM designs d WHERE `+where, args...).Scan(&total)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load submissions")
+		return
+	}
+
+	rows, err := a.db.QueryContext(
+		r.Context(),
+		adminSubmissionsQuery(where),
+		append(args, queryLimit, offset)...,
+	)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load submissions")
+		return
+	}
+	defer rows.Close()
+
+	submissions := make([]adminSubmissionRecord, 0)
+	for rows.Next() {
+		var userEmail string
+		design, err := scanDesign(rows, &userEmail)
+		if err != nil {
+			if errors.Is(err, errCorruptDesignData) {
+				writeError(w, http.StatusInternalServerError, codeInternal, "corrupt design data")
+				return
+			}
+			writeError(w, http.StatusInternalServerError, codeInternal, "unable to load submissions")
+			return
+		}
+
+		submissions = append(submissions, newAdminSubmissionRecord(design, userEmail))
+	}
+
+	if err := rows.Err(); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load submissions")
+		return
+	}
+
+	response := adminSubmissionsResponse{Designs: submissions, Offset: offset, Total: total}
+	if paged {
+		setPaginationHeaders(w, r, total, limit, offset)
+		response.Limit = &limit
+	} else {
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func adminSubmissionsQuery(where string) string {
+	return `SELECT ` + designColumns + `, u.email
+		 FROM designs d
+		 JOIN users u ON u.id = d.user_id
+		 WHERE ` + where + `
+		 ORDER BY d.updated_at DESC, d.id DESC
+		 LIMIT ? OFFSET ?`
+}
+
+func (a *app) handleAdminExport(w http.ResponseWriter, r *http.Request) {
+	conditions := []string{"1 = 1"}
+	args := make([]interface{}, 0, 1)
+	if rawStatus := strings.TrimSpace(r.URL.Query().Get("status")); rawStatus != "" {
+		status, ok := parseDesignStatus(rawStatus)
+		if !ok {
+			writeError(w, http.StatusBadRequest, codeInvalidQuery, "status is invalid")
+			return
+		}
+		conditions = append(conditions, "d.status = ?")
+		args = append(args, string(status))
+	}
+
+	rows, err := a.db.QueryContext(
+		r.Context(),
+		`SELECT `+designColumns+`, u.email
+		 FROM designs d
+		 JOIN users u ON u.id = d.user_id
+		 WHERE `+strings.Join(conditions, " AND ")+`
+		 ORDER BY d.id`,
+		args...,
+	)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load designs")
+		return
+	}
+	defer rows.Close()
+
+	header := []string{"designId", "name", "userEmail", "status", "rejectionReason", "submittedAt", "createdAt", "updatedAt"}
+	for _, material := range defaultCatalog.Materials {
+		header = append(header, material.Key+".colorHex", material.Key+".finish", material.Key+".patternId")
+	}
+
+	filename := fmt.Sprintf("designs-%s.csv", time.Now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	writer := csv.NewWriter(w)
+	_ = writer.Write(header)
+	for rows.Next() {
+		var userEmail string
+		design, err := scanDesign(rows, &userEmail)
+		if err != nil {
+			log.Printf("admin export: skipping design: %v", err)
+			continue
+		}
+
+		row := []string{design.ID, csvSafe(design.Name), csvSafe(userEmail), string(design.Status), "", "", design.CreatedAt, design.UpdatedAt}
+		if design.RejectionReason != nil {
+			row[4] = csvSafe(*design.RejectionReason)
+		}
+		if design.SubmittedAt != nil {
+			row[5] = *design.SubmittedAt
+		}
+		for _, material := range defaultCatalog.Materials {
+			selection := design.Materials[material.Key]
+			row = append(row, selection.ColorHex, selection.Finish, selection.PatternID)
+		}
+		if err := writer.Write(row); err != nil {
+			log.Printf("admin export: write failed: %v", err)
+			return
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("admin export: %v", err)
+	}
+	writer.Flush()
+}
+
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func (a *app) handleAdminGetDesign(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, codeInvalidDesignID, "design id is invalid")
+		return
+	}
+
+	var userEmail string
+	design, err := scanDesign(
+		a.db.QueryRowContext(
+			r.Context(),
+			`SELECT `+designColumns+`, u.email
+			 FROM designs d
+			 JOIN users u ON u.id = d.user_id
+			 WHERE d.id = ?`,
+			id,
+		),
+		&userEmail,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+			return
+		}
+		if errors.Is(err, errCorruptDesignData) {
+			writeError(w, http.StatusInternalServerError, codeInternal, "corrupt design data")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load design")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newAdminSubmissionRecord(design, userEmail))
+}
+
+func (a *app) handleAdminTransferDesign(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, codeInvalidDesignID, "design id is invalid")
+		return
+	}
+
+	var req transferDesignRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	email := strings.TrimSpace(strings.ToLower(req.TargetEmail))
+	if !emailRegex.MatchString(email) {
+		writeError(w, http.StatusBadRequest, codeInvalidEmail, "target email is invalid")
+		return
+	}
+
+	record, err := a.findDesignByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load design")
+		return
+	}
+
+	target, err := a.findUserByEmail(r.Context(), email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, codeUserNotFound, "target user not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load target user")
+		return
+	}
+
+	tx, err := a.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to transfer design")
+		return
+	}
+	defer tx.Rollback()
+
+	updatedAt := time.Now().UTC().Format(time.RFC3339)
+	_, err = tx.ExecContext(
+		r.Context(),
+		`UPDATE designs SET user_id = ?, version = version + 1, updated_at = ? WHERE id = ?`,
+		target.ID,
+		updatedAt,
+		id,
+	)
+	if err != nil {
+		if isDuplicateNameError(err) {
+			writeError(w, http.StatusConflict, codeDuplicateName, "target user already has a design with this name")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to transfer design")
+		return
+	}
+
+	if _, err := tx.ExecContext(r.Context(), `DELETE FROM idempotency_keys WHERE design_id = ?`, id); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to transfer design")
+		return
+	}
+
+	details := fmt.Sprintf("from user %d to user %d (%s)", record.UserID, target.ID, target.Email)
+	if err := recordAdminAudit(r.Context(), tx, "design.transfer", id, details, sql.NullString{}); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to transfer design")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to transfer design")
+		return
+	}
+
+	updatedRecord, err := a.findDesignByID(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load design")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newAdminSubmissionRecord(updatedRecord, target.Email))
+}
+
+func (a *app) handleAdminCountSubmissions(w http.ResponseWriter, r *http.Request) {
+	var pending int
+	err := a.db.QueryRowContext(
+		r.Context(),
+		`SELECT COUNT(*) FROM designs WHERE status = ?`,
+		string(statusSubmitted),
+	).Scan(&pending)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to count submissions")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]int{"pending": pending})
+}
+
+func (a *app) handleAdminApproveDesign(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, codeInvalidDesignID, "design id is invalid")
+		return
+	}
+
+	record, err := a.findDesignByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load design")
+		return
+	}
+	if record.Status != statusSubmitted {
+		writeError(w, http.StatusConflict, codeInvalidStatusChange, "only submitted designs can be approved")
+		return
+	}
+
+	updatedRecord, err := a.setDesignStatus(r.Context(), id, statusApproved, nil)
+	if err != nil {
+		if errors.Is(err, errStatusChanged) {
+			writeError(w, http.StatusConflict, codeInvalidStatusChange, err.Error())
+			return
+		}
+		if errors.Is(err, errDatabaseBusy) {
+			writeError(w, http.StatusServiceUnavailable, codeDatabaseBusy, "database is busy, try again")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to approve design")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, updatedRecord)
+}
+
+func (a *app) handleAdminRejectDesign(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, codeInvalidDesignID, "design id is invalid")
+		return
+	}
+
+	record, err := a.findDesignByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load design")
+		return
+	}
+	if record.Status != statusSubmitted {
+		writeError(w, http.StatusConflict, codeInvalidStatusChange, "only submitted designs can be rejected")
+		return
+	}
+
+	var req rejectRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		writeError(w, http.StatusBadRequest, codeMissingField, "rejection reason is required")
+		return
+	}
+
+	updatedRecord, err := a.setDesignStatus(r.Context(), id, statusRejected, &reason)
+	if err != nil {
+		if errors.Is(err, errStatusChanged) {
+			writeError(w, http.StatusConflict, codeInvalidStatusChange, err.Error())
+			return
+		}
+		if errors.Is(err, errDatabaseBusy) {
+			writeError(w, http.StatusServiceUnavailable, codeDatabaseBusy, "database is busy, try again")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to reject design")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, updatedRecord)
+}
+
+func (a *app) handleAdminUndoRejectDesign(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, codeInvalidDesignID, "design id is invalid")
+		return
+	}
+
+	record, err := a.findDesignByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, codeDesignNotFound, "design not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load design")
+		return
+	}
+	if record.Status != statusRejected {
+		writeError(w, http.StatusConflict, codeInvalidStatusChange, "only rejected designs can be returned to review")
+		return
+	}
+
+	tx, err := a.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to undo rejection")
+		return
+	}
+	defer tx.Rollback()
+
+	affected, err := updateDesignStatus(r.Context(), tx, id, statusSubmitted, nil, statusRejected)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to undo rejection")
+		return
+	}
+	if affected == 0 {
+		writeError(w, http.StatusConflict, codeVersionConflict, "design status changed, please retry")
+		return
+	}
+
+	details := "cleared rejection reason"
+	if record.RejectionReason != nil {
+		details = fmt.Sprintf("cleared rejection reason %q", *record.RejectionReason)
+	}
+	if err := recordAdminAudit(r.Context(), tx, "design.unreject", id, details, sql.NullString{}); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to undo rejection")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to undo rejection")
+		return
+	}
+
+	updatedRecord, err := a.findDesignByID(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load design")
+		return
+	}
+	a.designEvents.publish(updatedRecord)
+
+	writeJSON(w, http.StatusOK, updatedRecord)
+}
+
+func (a *app) handleAdminListUsers(w http.ResponseWriter, r *http.Request) {
+	paged := r.URL.Query().Has("limit") || r.URL.Query().Has("offset")
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidQuery, err.Error())
+		return
+	}
+	queryLimit := -1
+	if paged {
+		queryLimit = limit
+	}
+
+	var total int
+	if err := a.db.QueryRowContext(r.Context(), `SELECT COUNT(*) FROM users`).Scan(&total); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load users")
+		return
+	}
+
+	rows, err := a.db.QueryContext(
+		r.Context(),
+		`SELECT u.id, u.email, u.is_admin, u.signup_ip, u.signup_user_agent, u.last_login_at, u.created_at,
+		   (SELECT COUNT(*) FROM login_attempts l WHERE l.email = u.email AND l.success = 0 AND l.created_at >= ?),
+		   (SELECT MAX(l.created_at) FROM login_attempts l WHERE l.email = u.email AND l.success = 0)
+		 FROM users u
+		 ORDER BY u.created_at DESC, u.id DESC
+		 LIMIT ? OFFSET ?`,
+		time.Now().UTC().Add(-24*time.Hour).Format(time.RFC3339),
+		queryLimit,
+		offset,
+	)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load users")
+		return
+	}
+	defer rows.Close()
+
+	users := make([]adminUserRecord, 0)
+	for rows.Next() {
+		var (
+			id              int64
+			record          adminUserRecord
+			signupIP        sql.NullString
+			signupUserAgent sql.NullString
+			lastLoginAt     sql.NullString
+			lastFailedLogin sql.NullString
+		)
+		err := rows.Scan(
+			&id,
+			&record.Email,
+			&record.IsAdmin,
+			&signupIP,
+			&signupUserAgent,
+			&lastLoginAt,
+			&record.CreatedAt,
+			&record.FailedLogins24h,
+			&lastFailedLogin,
+		)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "unable to load users")
+			return
+		}
+
+		record.ID = strconv.FormatInt(id, 10)
+		if signupIP.Valid {
+			ip := signupIP.String
+			record.SignupIP = &ip
+		}
+		if signupUserAgent.Valid {
+			userAgent := signupUserAgent.String
+			record.SignupUserAgent = &userAgent
+		}
+		if lastLoginAt.Valid {
+			lastLogin := lastLoginAt.String
+			record.LastLoginAt = &lastLogin
+		}
+		if lastFailedLogin.Valid {
+			lastFailed := lastFailedLogin.String
+			record.LastFailedLogin = &lastFailed
+		}
+		users = append(users, record)
+	}
+
+	if err := rows.Err(); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load users")
+		return
+	}
+
+	response := adminUsersResponse{Offset: offset, Total: total, Users: users}
+	if paged {
+		setPaginationHeaders(w, r, total, limit, offset)
+		response.Limit = &limit
+	} else {
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (a *app) handleAdminRevokeTokens(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, codeInvalidUserID, "user id is invalid")
+		return
+	}
+
+	invalidBefore := time.Now().UTC().Format(time.RFC3339Nano)
+	result, err := a.db.ExecContext(
+		r.Context(),
+		`UPDATE users SET tokens_invalid_before = ? WHERE id = ?`,
+		invalidBefore,
+		id,
+	)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to revoke tokens")
+		return
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to revoke tokens")
+		return
+	}
+	if affected == 0 {
+		writeError(w, http.StatusNotFound, codeUserNotFound, "user not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"id":                  strconv.FormatInt(id, 10),
+		"tokensInvalidBefore": invalidBefore,
+	})
+}
+
+func (a *app) handleAdminListCorruptDesigns(w http.ResponseWriter, r *http.Request) {
+	rows, err := a.db.QueryContext(
+		r.Context(),
+		`SELECT id, user_id, name, selections_json, updated_at FROM designs ORDER BY id`,
+	)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load designs")
+		return
+	}
+	defer rows.Close()
+
+	designs := make([]corruptDesignRecord, 0)
+	for rows.Next() {
+		var (
+			id, userID     int64
+			name           string
+			selectionsJSON string
+			updatedAt      string
+		)
+		if err := rows.Scan(&id, &userID, &name, &selectionsJSON, &updatedAt); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "unable to load designs")
+			return
+		}
+
+		selections := map[string]materialSelection{}
+		err := json.Unmarshal([]byte(selectionsJSON), &selections)
+		if err == nil {
+			continue
+		}
+
+		designs = append(designs, corruptDesignRecord{
+			Error:     err.Error(),
+			ID:        strconv.FormatInt(id, 10),
+			Name:      name,
+			UpdatedAt: updatedAt,
+			UserID:    strconv.FormatInt(userID, 10),
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load designs")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string][]corruptDesignRecord{
+		"designs": designs,
+	})
+}
+
+func (a *app) handleAdminMaterialAnalytics(w http.ResponseWriter, r *http.Request) {
+	topN := defaultAnalyticsTopN
+	if raw := strings.TrimSpace(r.URL.Query().Get("top")); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			writeError(w, http.StatusBadRequest, codeInvalidQuery, "top must be a positive integer")
+			return
+		}
+		topN = min(parsed, maxAnalyticsTopN)
+	}
+
+	rows, err := a.db.QueryContext(r.Context(), `SELECT selections_json FROM designs`)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load analytics")
+		return
+	}
+	defer rows.Close()
+
+	type tally struct {
+		colors      map[string]int
+		designCount int
+		finishes    map[string]int
+		patterns    map[string]int
+	}
+	tallies := map[string]*tally{}
+
+	for rows.Next() {
+		var selectionsJSON string
+		if err := rows.Scan(&selectionsJSON); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "unable to load analytics")
+			return
+		}
+
+		selections := map[string]materialSelection{}
+		if err := json.Unmarshal([]byte(selectionsJSON), &selections); err != nil {
+			continue
+		}
+
+		for key, selection := range selections {
+			entry, ok := tallies[key]
+			if !ok {
+				entry = &tally{
+					colors:   map[string]int{},
+					finishes: map[string]int{},
+					patterns: map[string]int{},
+				}
+				tallies[key] = entry
+			}
+			entry.designCount++
+			entry.colors[strings.ToUpper(selection.ColorHex)]++
+			entry.finishes[selection.Finish]++
+			entry.patterns[selection.PatternID]++
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load analytics")
+		return
+	}
+
+	materials := make([]materialUsageRecord, 0, len(defaultCatalog.Materials))
+	for _, material := range defaultCatalog.Materials {
+		record := materialUsageRecord{
+			Colors:   []optionCount{},
+			Finishes: []optionCount{},
+			Key:      material.Key,
+			Name:     material.Name,
+			Patterns: []optionCount{},
+		}
+		if entry, ok := tallies[material.Key]; ok {
+			record.Colors = topOptionCounts(entry.colors, topN)
+			record.DesignCount = entry.designCount
+			record.Finishes = topOptionCounts(entry.finishes, topN)
+			record.Patterns = topOptionCounts(entry.patterns, topN)
+		}
+		materials = append(materials, record)
+	}
+
+	writeJSON(w, http.StatusOK, map[string][]materialUsageRecord{
+		"materials": materials,
+	})
+}
+
+func (a *app) handleAdminFinishAnalytics(w http.ResponseWriter, r *http.Request) {
+	var status designStatus
+	query := `SELECT selections_json FROM designs`
+	args := []any{}
+	if rawStatus := strings.TrimSpace(r.URL.Query().Get("status")); rawStatus != "" {
+		parsed, ok := parseDesignStatus(rawStatus)
+		if !ok {
+			writeError(w, http.StatusBadRequest, codeInvalidQuery, "status is invalid")
+			return
+		}
+		status = parsed
+		query += ` WHERE status = ?`
+		args = append(args, string(status))
+	}
+
+	rows, err := a.db.QueryContext(r.Context(), query, args...)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load analytics")
+		return
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for _, finish := range defaultCatalog.AllowedFinishes {
+		counts[finish] = 0
+	}
+	response := finishUsageResponse{Status: status}
+
+	for rows.Next() {
+		var selectionsJSON string
+		if err := rows.Scan(&selectionsJSON); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "unable to load analytics")
+			return
+		}
+
+		selections := map[string]materialSelection{}
+		if err := json.Unmarshal([]byte(selectionsJSON), &selections); err != nil {
+			continue
+		}
+
+		response.DesignCount++
+		for _, selection := range selections {
+			finish := strings.ToUpper(strings.TrimSpace(selection.Finish))
+			if finish == "" {
+				continue
+			}
+			counts[finish]++
+			response.SelectionCount++
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load analytics")
+		return
+	}
+
+	response.Finishes = topOptionCounts(counts, len(counts))
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (a *app) handleAdminTurnaroundAnalytics(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	groupBy := strings.ToLower(strings.TrimSpace(query.Get("groupBy")))
+	switch groupBy {
+	case "":
+		groupBy = "day"
+	case "day", "week":
+	default:
+		writeError(w, http.StatusBadRequest, codeInvalidQuery, "groupBy must be day or week")
+		return
+	}
+
+	conditions := []string{`action IN ('design.approve', 'design.reject')`, `submitted_at IS NOT NULL`}
+	rangeConditions, args, err := parseTimeRange(query, "created_at", "decidedAfter", "decidedBefore")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidQuery, err.Error())
+		return
+	}
+	conditions = append(conditions, rangeConditions...)
+
+	rows, err := a.db.QueryContext(
+		r.Context(),
+		`SELECT action, submitted_at, created_at FROM admin_audit_log WHERE `+strings.Join(conditions, " AND "),
+		args...,
+	)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load analytics")
+		return
+	}
+	defer rows.Close()
+
+	type decision struct {
+		approved bool
+		seconds  float64
+	}
+	periods := map[string][]decision{}
+	all := make([]decision, 0)
+	for rows.Next() {
+		var action, rawSubmittedAt, rawDecidedAt string
+		if err := rows.Scan(&action, &rawSubmittedAt, &rawDecidedAt); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "unable to load analytics")
+			return
+		}
+
+		submittedAt, err := time.Parse(time.RFC3339, rawSubmittedAt)
+		if err != nil {
+			continue
+		}
+		decidedAt, err := time.Parse(time.RFC3339, rawDecidedAt)
+		if err != nil {
+			continue
+		}
+
+		period := decidedAt.UTC()
+		if groupBy == "week" {
+			period = period.AddDate(0, 0, -((int(period.Weekday()) + 6) % 7))
+		}
+		key := period.Format("2006-01-02")
+
+		entry := decision{
+			approved: action == "design.approve",
+			seconds:  math.Max(decidedAt.Sub(submittedAt).Seconds(), 0),
+		}
+		periods[key] = append(periods[key], entry)
+		all = append(all, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load analytics")
+		return
+	}
+
+	summarize := func(period string, decisions []decision) turnaroundBucket {
+		bucket := turnaroundBucket{Count: len(decisions), Period: period}
+		if len(decisions) == 0 {
+			return bucket
+		}
+
+		durations := make([]float64, 0, len(decisions))
+		total := 0.0
+		for _, entry := range decisions {
+			if entry.approved {
+				bucket.Approved++
+			} else {
+				bucket.Rejected++
+			}
+			durations = append(durations, entry.seconds)
+			total += entry.seconds
+		}
+		sort.Float64s(durations)
+
+		bucket.AverageSeconds = total / float64(len(durations))
+		middle := len(durations) / 2
+		if len(durations)%2 == 0 {
+			bucket.MedianSeconds = (durations[middle-1] + durations[middle]) / 2
+		} else {
+			bucket.MedianSeconds = durations[middle]
+		}
+		return bucket
+	}
+
+	keys := make([]string, 0, len(periods))
+	for key := range periods {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	buckets := make([]turnaroundBucket, 0, len(keys))
+	for _, key := range keys {
+		buckets = append(buckets, summarize(key, periods[key]))
+	}
+
+	writeJSON(w, http.StatusOK, turnaroundResponse{
+		Buckets: buckets,
+		GroupBy: groupBy,
+		Overall: summarize("", all),
+	})
+}
+
+func (a *app) handleActiveNotices(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	rows, err := a.db.QueryContext(
+		r.Context(),
+		`SELECT id, message, active, expires_at, created_at
+		 FROM notices
+		 WHERE active = 1 AND (expires_at IS NULL OR expires_at > ?)
+		 ORDER BY created_at DESC`,
+		now,
+	)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load notices")
+		return
+	}
+	defer rows.Close()
+
+	notices := make([]noticeRecord, 0)
+	for rows.Next() {
+		var (
+			id        int64
+			message   string
+			active    bool
+			expiresAt sql.NullString
+			createdAt string
+		)
+		if err := rows.Scan(&id, &message, &active, &expiresAt, &createdAt); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "unable to load notices")
+			return
+		}
+
+		record := noticeRecord{
+			Active:    active,
+			CreatedAt: createdAt,
+			ID:        strconv.FormatInt(id, 10),
+			Message:   message,
+		}
+		if expiresAt.Valid {
+			expires := expiresAt.String
+			record.ExpiresAt = &expires
+		}
+		notices = append(notices, record)
+	}
+
+	if err := rows.Err(); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load notices")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string][]noticeRecord{
+		"notices": notices,
+	})
+}
+
+func (a *app) handleAdminGetSettings(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, a.currentSettings())
+}
+
+func (a *app) handleAdminPutSetting(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+
+	var req settingValueRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	if len(req.Value) == 0 {
+		writeError(w, http.StatusBadRequest, codeMissingField, "value is required")
+		return
+	}
+
+	settings := a.currentSettings()
+	if err := settings.apply(key, string(req.Value)); err != nil {
+		if errors.Is(err, errUnknownSetting) {
+			writeError(w, http.StatusNotFound, codeSettingNotFound, err.Error())
+			return
+		}
+		writeError(w, http.StatusBadRequest, codeInvalidSettingValue, err.Error())
+		return
+	}
+
+	_, err := a.db.ExecContext(
+		r.Context(),
+		`INSERT INTO settings(key, value, updated_at) VALUES (?, ?, ?)
+		 ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+		key,
+		string(req.Value),
+		time.Now().UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to save setting")
+		return
+	}
+
+	if err := a.loadSettings(r.Context()); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to load settings")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, a.currentSettings())
+}
+
+func (a *app) handleAdminCreateNotice(w http.ResponseWriter, r *http.Request) {
+	var req noticeCreateRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	message := strings.TrimSpace(req.Message)
+	if message == "" {
+		writeError(w, http.StatusBadRequest, codeMissingField, "notice message is required")
+		return
+	}
+
+	active := true
+	if req.Active != nil {
+		active = *req.Active
+	}
+
+	var expiresAt *string
+	if req.ExpiresAt != nil && strings.TrimSpace(*req.ExpiresAt) != "" {
+		parsed, err := time.Parse(time.RFC3339, strings.TrimSpace(*req.ExpiresAt))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidRequestBody, "expiresAt must be an RFC3339 timestamp")
+			return
+		}
+		expires := parsed.UTC().Format(time.RFC3339)
+		expiresAt = &expires
+	}
+
+	createdAt := time.Now().UTC().Format(time.RFC3339)
+	result, err := a.db.ExecContext(
+		r.Context(),
+		`INSERT INTO notices(message, active, expires_at, created_at) VALUES (?, ?, ?, ?)`,
+		message,
+		active,
+		expiresAt,
+		createdAt,
+	)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to create notice")
+		return
+	}
+
+	insertID, err := result.LastInsertId()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to create notice")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, noticeRecord{
+		Active:    active,
+		CreatedAt: createdAt,
+		ExpiresAt: expiresAt,
+		ID:        strconv.FormatInt(insertID, 10),
+		Message:   message,
+	})
+}
+
+func (a *app) handleAdminDeactivateNotice(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, codeInvalidNoticeID, "notice id is invalid")
+		return
+	}
+
+	result, err := a.db.ExecContext(r.Context(), `UPDATE notices SET active = 0 WHERE id = ?`, id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to deactivate notice")
+		return
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "unable to deactivate notice")
+		return
+	}
+	if affected == 0 {
+		writeError(w, http.StatusNotFound, codeNoticeNotFound, "notice not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *app) setDesignStatus(
+	ctx context.Context,
+	id int64,
+	status designStatus,
+	rejectionReason *string,
+) (designRecord, error) {
+	action, details := "design.approve", "approved"
+	if status == statusRejected {
+		action, details = "design.reject", "rejected"
+		if rejectionReason != nil {
+			details = fmt.Sprintf("rejected: %q", *rejectionReason)
+		}
+	}
+
+	err := retryOnBusy(ctx, func() error {
+		tx, err := a.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		var submittedAt sql.NullString
+		if err := tx.QueryRowContext(ctx, `SELECT submitted_at FROM designs WHERE id = ?`, id).Scan(&submittedAt); err != nil {
+			return err
+		}
+		affected, err := updateDesignStatus(ctx, tx, id, status, rejectionReason, statusSubmitted)
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return errStatusChanged
+		}
+		if err := recordAdminAudit(ctx, tx, action, id, details, submittedAt); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		return designRecord{}, err
+	}
+
+	record, err := a.findDesignByID(ctx, id)
+	if err != nil {
+		return designRecord{}, err
+	}
+	a.designEvents.publish(record)
+	return record, nil
+}
+
+func newUserRateLimiter(limit int, window time.Duration) *userRateLimiter {
+	return &userRateLimiter{limit: limit, window: window, windows: map[int64]*rateWindow{}}
+}
+
+func (l *userRateLimiter) allow(userID int64, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= l.window {
+		for id, entry := range l.windows {
+			if now.Sub(entry.start) >= l.window {
+				delete(l.windows, id)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	entry, ok := l.windows[userID]
+	if !ok || now.Sub(entry.start) >= l.window {
+		entry = &rateWindow{start: now}
+		l.windows[userID] = entry
+	}
+	if entry.count >= l.limit {
+		return false, entry.start.Add(l.window).Sub(now)
+	}
+	entry.count++
+	return true, 0
+}
+
+func capPprofSeconds(
+	writeTimeout time.Duration,
+	defaultSeconds int,
+	next func(http.ResponseWriter, *http.Request),
+) func(http.ResponseWriter, *http.Request) {
+	maxSeconds := max(int((writeTimeout-5*time.Second)/time.Second), 1)
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		seconds, err := strconv.Atoi(query.Get("seconds"))
+		if err != nil || seconds <= 0 {
+			seconds = defaultSeconds
+		}
+		if seconds > maxSeconds {
+			query.Set("seconds", strconv.Itoa(maxSeconds))
+			r.URL.RawQuery = query.Encode()
+		}
+		next(w, r)
+	}
+}
+
+func (a *app) limitWrites(
+	next func(http.ResponseWriter, *http.Request, userRecord),
+) func(http.ResponseWriter, *http.Request, userRecord) {
+	return func(w http.ResponseWriter, r *http.Request, user userRecord) {
+		if a.writeLimiter != nil {
+			if ok, retryAfter := a.writeLimiter.allow(user.ID, time.Now()); !ok {
+				seconds := int(math.Ceil(retryAfter.Seconds()))
+				w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+				writeError(w, http.StatusTooManyRequests, codeRateLimited, "too many requests, slow down")
+				return
+			}
+		}
+		next(w, r, user)
+	}
+}
+
+func newDesignEventHub() *designEventHub {
+	return &designEventHub{subscribers: map[int64]map[chan designStatusRecord]struct{}{}}
+}
+
+func (h *designEventHub) subscribe(designID int64) (<-chan designStatusRecord, func()) {
+	events := make(chan designStatusRecord, 8)
+
+	h.mu.Lock()
+	if h.subscribers[designID] == nil {
+		h.subscribers[designID] = map[chan designStatusRecord]struct{}{}
+	}
+	h.subscribers[designID][events] = struct{}{}
+	h.mu.Unlock()
+
+	unsubscribe := func() {
+		h.mu.Lock()
+		delete(h.subscribers[designID], events)
+		if len(h.subscribers[designID]) == 0 {
+			delete(h.subscribers, designID)
+		}
+		h.mu.Unlock()
+	}
+	return events, unsubscribe
+}
+
+func (h *designEventHub) publish(record designRecord) {
+	event := designStatusRecord{
+		RejectionReason: record.RejectionReason,
+		Status:          record.Status,
+		UpdatedAt:       record.UpdatedAt,
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for events := range h.subscribers[record.DatabaseID] {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+func retryOnBusy(ctx context.Context, op func() error) error {
+	deadline := time.Now().Add(busyRetryMaxWait)
+	delay := busyRetryBaseDelay
+	for {
+		err := op()
+		if err == nil || !isBusyError(err) {
+			return err
+		}
+
+		wait := delay/2 + mathrand.N(delay/2+1)
+		if time.Now().Add(wait).After(deadline) {
+			return fmt.Errorf("%w: %v", errDatabaseBusy, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		delay *= 2
+	}
+}
+
+func isBusyError(err error) bool {
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "database is locked") ||
+		strings.Contains(message, "database table is locked")
+}
+
+func updateDesignStatus(
+	ctx context.Context,
+	db sqlExecer,
+	id int64,
+	status designStatus,
+	rejectionReason *string,
+	fromStatuses ...designStatus,
+) (int64, error) {
+	updatedAt := time.Now().UTC().Format(time.RFC3339)
+	statement := `UPDATE designs SET status = ?, rejection_reason = ?,
+		submitted_at = CASE ? WHEN 'SUBMITTED' THEN ? WHEN 'DRAFT' THEN NULL ELSE submitted_at END,
+		rejected_at = CASE ? WHEN 'REJECTED' THEN ? ELSE NULL END, rejection_seen_at = NULL,
+		version = version + 1, updated_at = ? WHERE id = ?`
+	args := []interface{}{
+		string(status), rejectionReason, string(status), updatedAt, string(status), updatedAt, updatedAt, id,
+	}
+
+	if len(fromStatuses) > 0 {
+		placeholders := make([]string, 0, len(fromStatuses))
+		for _, from := range fromStatuses {
+			placeholders = append(placeholders, "?")
+			args = append(args, string(from))
+		}
+		statement += ` AND status IN (` + strings.Join(placeholders, ", ") + `)`
+	}
+
+	result, err := db.ExecContext(ctx, statement, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func recordSelectionChange(
+	ctx context.Context,
+	tx *timedTx,
+	designID int64,
+	version int64,
+	diff materialDiff,
+	changedAt string,
+) error {
+	args := []interface{}{designID, version, diff.Key, strings.Join(diff.ChangedFields, ",")}
+	for _, selection := range []*materialSelection{diff.Left, diff.Right} {
+		if selection == nil {
+			args = append(args, nil, nil, nil)
+			continue
+		}
+		args = append(args, selection.ColorHex, selection.Finish, selection.PatternID)
+	}
+	args = append(args, changedAt)
+
+	_, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO selection_changes(
+		   design_id, version, material_key, changed_fields,
+		   old_color_hex, old_finish, old_pattern_id,
+		   new_color_hex, new_finish, new_pattern_id,
+		   changed_at
+		 ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		args...,
+	)
+	return err
+}
+
+func recordAdminAudit(
+	ctx context.Context,
+	tx *timedTx,
+	action string,
+	designID int64,
+	details string,
+	submittedAt sql.NullString,
+) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO admin_audit_log(action, design_id, details, submitted_at, created_at) VALUES (?, ?, ?, ?, ?)`,
+		action,
+		designID,
+		details,
+		submittedAt,
+		time.Now().UTC().Format(time.RFC3339),
+	)
+	return err
+}
+
+func (db *timedDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*timedTx, error) {
+	tx, err := db.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &timedTx{Tx: tx, db: db}, nil
+}
+
+func (db *timedDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.ExecContext(context.Background(), query, args...)
+}
+
+func (db *timedDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.QueryContext(context.Background(), query, args...)
+}
+
+func (db *timedDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return db.QueryRowContext(context.Background(), query, args...)
+}
+
+func (db *timedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	started := time.Now()
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	db.observe(ctx, query, started)
+	return rows, err
+}
+
+func (db *timedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	started := time.Now()
+	row := db.DB.QueryRowContext(ctx, query, args...)
+	db.observe(ctx, query, started)
+	return row
+}
+
+func (db *timedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	started := time.Now()
+	result, err := db.DB.ExecContext(ctx, query, args...)
+	db.observe(ctx, query, started)
+	return result, err
+}
+
+func (tx *timedTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.ExecContext(context.Background(), query, args...)
+}
+
+func (tx *timedTx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.QueryContext(context.Background(), query, args...)
+}
+
+func (tx *timedTx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return tx.QueryRowContext(context.Background(), query, args...)
+}
+
+func (tx *timedTx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	started := time.Now()
+	rows, err := tx.Tx.QueryContext(ctx, query, args...)
+	tx.db.observe(ctx, query, started)
+	return rows, err
+}
+
+func (tx *timedTx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	started := time.Now()
+	row := tx.Tx.QueryRowContext(ctx, query, args...)
+	tx.db.observe(ctx, query, started)
+	return row
+}
+
+func (tx *timedTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	started := time.Now()
+	result, err := tx.Tx.ExecContext(ctx, query, args...)
+	tx.db.observe(ctx, query, started)
+	return result, err
+}
+
+func (db *timedDB) observe(ctx context.Context, query string, started time.Time) {
+	if db.slowQueryThreshold <= 0 {
+		return
+	}
+	elapsed := time.Since(started)
+	if elapsed < db.slowQueryThreshold {
+		return
+	}
+
+	handler, ok := ctx.Value(handlerKey).(string)
+	if !ok {
+		handler = "unknown"
+	}
+	requestID, _ := ctx.Value(requestIDKey).(string)
+
+	entry, err := json.Marshal(slowQueryLog{
+		DurationMS: float64(elapsed.Microseconds()) / 1000,
+		Handler:    handler,
+		Level:      "warn",
+		Message:    "slow query",
+		Query:      strings.Join(strings.Fields(query), " "),
+		RequestID:  requestID,
+	})
+	if err != nil {
+		return
+	}
+	log.Print(string(entry))
+}
+
+type sqlExecer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func marshalSelections(selections map[string]materialSelection) ([]byte, error) {
+	keys := make([]string, 0, len(selections))
+	for key := range selections {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		encodedKey, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		encodedValue, err := json.Marshal(selections[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(encodedKey)
+		buf.WriteByte(':')
+		buf.Write(encodedValue)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (a *app) findDuplicateDesign(
+	ctx context.Context,
+	userID int64,
+	selections map[string]materialSelection,
+) (int64, error) {
+	selectionsJSON, err := marshalSelections(selections)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err = a.db.QueryRowContext(
+		ctx,
+		`SELECT id FROM designs WHERE user_id = ? AND selections_json = ? ORDER BY id LIMIT 1`,
+		userID,
+		string(selectionsJSON),
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return id, err
+}
+
+func insertDesign(
+	ctx context.Context,
+	db sqlExecer,
+	userID int64,
+	name string,
+	selections map[string]materialSelection,
+	maxDesigns int,
+) (designRecord, error) {
+	selectionsJSON, err := marshalSelections(selections)
+	if err != nil {
+		return designRecord{}, err
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	result, err := db.ExecContext(
+		ctx,
+		`INSERT INTO designs(user_id, name, name_key, selections_json, status, rejection_reason, created_at, updated_at)
+		 SELECT ?, ?, ?, ?, ?, NULL, ?, ?
+		 WHERE ? <= 0 OR (SELECT COUNT(*) FROM designs WHERE user_id = ?) < ?`,
+		userID,
+		name,
+		designNameKey(name),
+		string(selectionsJSON),
+		string(statusDraft),
+		now,
+		now,
+		maxDesigns,
+		userID,
+		maxDesigns,
+	)
+	if err != nil {
+		if isDuplicateNameError(err) {
+			return designRecord{}, errDuplicateName
+		}
+		return designRecord{}, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return designRecord{}, err
+	}
+	if affected == 0 {
+		return designRecord{}, errDesignLimit
+	}
+
+	insertID, err := result.LastInsertId()
+	if err != nil {
+		return designRecord{}, err
+	}
+
+	return designRecord{
+		CreatedAt:  now,
+		ID:         strconv.FormatInt(insertID, 10),
+		Materials:  selections,
+		Name:       name,
+		Status:     statusDraft,
+		Editable:   statusDraft.editable(),
+		UpdatedAt:  now,
+		UserID:     userID,
+		DatabaseID: insertID,
+		Version:    1,
+	}, nil
+}
+
+func (a *app) findIdempotentDesign(
+	ctx context.Context,
+	userID int64,
+	idempotencyKey string,
+) (designRecord, bool, error) {
+	cutoff := time.Now().UTC().Add(-idempotencyKeyTTL).Format(time.RFC3339)
+	if _, err := a.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE created_at <= ?`, cutoff); err != nil {
+		return designRecord{}, false, err
+	}
+
+	var designID int64
+	err := a.db.QueryRowContext(
+		ctx,
+		`SELECT design_id FROM idempotency_keys WHERE user_id = ? AND idem_key = ?`,
+		userID,
+		idempotencyKey,
+	).Scan(&designID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return designRecord{}, false, nil
+		}
+		return designRecord{}, false, err
+	}
+
+	record, err := a.findDesignByID(ctx, designID)
+	if err != nil {
+		return designRecord{}, false, err
+	}
+	return record, true, nil
+}
+
+func (a *app) currentSettings() runtimeSettings {
+	a.settingsMu.RLock()
+	defer a.settingsMu.RUnlock()
+	return a.settings
+}
+
+func (a *app) loadSettings(ctx context.Context) error {
+	rows, err := a.db.QueryContext(ctx, `SELECT key, value FROM settings`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	a.settingsMu.Lock()
+	defer a.settingsMu.Unlock()
+
+	settings := a.settings
 	for rows.Next() {
-		var (
-			cid       int
-			name      string
-			valueType string
-			notNull   int
-			defaultV  sql.NullString
-			primary   int
-		)
-		if err := rows.Scan(&cid, &name, &valueType, &notNull, &defaultV, &primary); err != nil {
-			return false, err
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return err
+		}
+		if err := settings.apply(key, value); err != nil {
+			log.Printf("ignoring stored setting %s: %v", key, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	a.settings = settings
+	return nil
+}
+
+func (s *runtimeSettings) apply(key, rawValue string) error {
+	switch key {
+	case "maintenance":
+		if err := json.Unmarshal([]byte(rawValue), &s.Maintenance); err != nil {
+			return errors.New("maintenance must be a boolean")
+		}
+	case "maxDesignsPerUser":
+		var value int
+		if err := json.Unmarshal([]byte(rawValue), &value); err != nil || value < 0 {
+			return errors.New("maxDesignsPerUser must be a non-negative integer")
+		}
+		s.MaxDesignsPerUser = value
+	case "requireFullSelection":
+		if err := json.Unmarshal([]byte(rawValue), &s.RequireFullSelection); err != nil {
+			return errors.New("requireFullSelection must be a boolean")
 		}
+	default:
+		return errUnknownSetting
+	}
+	return nil
+}
+
+func (a *app) checkDesignLimit(ctx context.Context, userID int64, adding int) error {
+	maxDesigns := a.currentSettings().MaxDesignsPerUser
+	if maxDesigns <= 0 {
+		return nil
+	}
+
+	var count int
+	err := a.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM designs WHERE user_id = ?`, userID).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count+adding > maxDesigns {
+		return errDesignLimit
+	}
+	return nil
+}
 
-		if strings.EqualFold(name, columnName) {
-			return true, nil
-		}
+func (a *app) checkDesignName(ctx context.Context, userID int64, name string, excludeID int64) error {
+	if !a.uniqueNames {
+		return nil
 	}
 
-	return false, rows.Err()
+	var exists bool
+	err := a.db.QueryRowContext(
+		ctx,
+		`SELECT EXISTS(SELECT 1 FROM designs WHERE user_id = ? AND LOWER(TRIM(name)) = LOWER(?) AND id != ?)`,
+		userID,
+		strings.TrimSpace(name),
+		excludeID,
+	).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return errDuplicateName
+	}
+	return nil
 }
 
-func (a *app) handleHealth(w http.ResponseWriter, _ *http.Request) {
-	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+func (a *app) findDesignByID(ctx context.Context, id int64) (designRecord, error) {
+	row := a.db.QueryRowContext(
+		ctx,
+		`SELECT `+designColumns+` FROM designs d WHERE d.id = ?`,
+		id,
+	)
+	return scanDesign(row)
 }
 
-func (a *app) handleCatalog(w http.ResponseWriter, _ *http.Request) {
-	writeJSON(w, http.StatusOK, defaultCatalog)
+type rowScanner interface {
+	Scan(dest ...interface{}) error
 }
 
-func (a *app) handleRegister(w http.ResponseWriter, r *http.Request) {
-	var req registerRequest
-	if err := decodeJSON(r, &req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid JSON payload")
-		return
-	}
+func scanDesign(row rowScanner, extra ...interface{}) (designRecord, error) {
+	var (
+		record          designRecord
+		selectionsJSON  string
+		statusValue     string
+		rejectionReason sql.NullString
+		submittedAt     sql.NullString
+	)
 
-	email := strings.TrimSpace(strings.ToLower(req.Email))
-	password := strings.TrimSpace(req.Password)
-	if !emailRegex.MatchString(email) {
-		writeError(w, http.StatusBadRequest, "email is invalid")
-		return
+	dest := []interface{}{
+		&record.DatabaseID,
+		&record.UserID,
+		&record.Name,
+		&selectionsJSON,
+		&statusValue,
+		&rejectionReason,
+		&submittedAt,
+		&record.Version,
+		&record.CreatedAt,
+		&record.UpdatedAt,
+		&record.HasThumbnail,
 	}
-	if len(password) < 8 {
-		writeError(w, http.StatusBadRequest, "password must be at least 8 characters")
-		return
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return designRecord{}, err
 	}
 
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "unable to hash password")
-		return
+	selections := map[string]materialSelection{}
+	if err := json.Unmarshal([]byte(selectionsJSON), &selections); err != nil {
+		return record, fmt.Errorf("%w: %v", errCorruptDesignData, err)
 	}
 
-	createdAt := time.Now().UTC().Format(time.RFC3339)
-	result, err := a.db.ExecContext(
-		r.Context(),
-		`INSERT INTO users(email, password_hash, created_at) VALUES (?, ?, ?)`,
-		email,
-		string(passwordHash),
-		createdAt,
-	)
+	createdAt, err := normalizeTimestamp(record.CreatedAt)
 	if err != nil {
-		if strings.Contains(strings.ToLower(err.Error()), "unique") {
-			writeError(w, http.StatusConflict, "email already registered")
+		return record, fmt.Errorf("%w: created_at: %v", errCorruptDesignData, err)
+	}
+	updatedAt, err := normalizeTimestamp(record.UpdatedAt)
+	if err != nil {
+		return record, fmt.Errorf("%w: updated_at: %v", errCorruptDesignData, err)
+	}
+
+	record.CreatedAt = createdAt
+	record.UpdatedAt = updatedAt
+	record.ID = strconv.FormatInt(record.DatabaseID, 10)
+	record.Materials = selections
+	record.Status = designStatus(statusValue)
+	record.Editable = record.Status.editable()
+	if rejectionReason.Valid {
+		reason := rejectionReason.String
+		record.RejectionReason = &reason
+	}
+	if submittedAt.Valid {
+		submitted, err := normalizeTimestamp(submittedAt.String)
+		if err != nil {
+			return record, fmt.Errorf("%w: submitted_at: %v", errCorruptDesignData, err)
+		}
+		record.SubmittedAt = &submitted
+	}
+	return record, nil
+}
+
+func newAdminSubmissionRecord(design designRecord, userEmail string) adminSubmissionRecord {
+	return adminSubmissionRecord{
+		CreatedAt:       design.CreatedAt,
+		ID:              design.ID,
+		Materials:       design.Materials,
+		Name:            design.Name,
+		RejectionReason: design.RejectionReason,
+		Status:          design.Status,
+		SubmittedAt:     design.SubmittedAt,
+		UpdatedAt:       design.UpdatedAt,
+		UserEmail:       userEmail,
+		UserID:          strconv.FormatInt(design.UserID, 10),
+		Version:         design.Version,
+	}
+}
+
+func (a *app) requireAuth(
+	next func(http.ResponseWriter, *http.Request, userRecord),
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := a.userFromRequest(r)
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, codeUnauthorized, "unauthorized")
 			return
 		}
-		writeError(w, http.StatusInternalServerError, "unable to register user")
-		return
+		readOnly := r.Method == http.MethodGet || r.Method == http.MethodHead
+		if !readOnly && !user.IsAdmin && a.currentSettings().Maintenance {
+			writeError(w, http.StatusServiceUnavailable, codeMaintenance, "service is in maintenance mode")
+			return
+		}
+		next(w, r, user)
 	}
+}
 
-	userID, err := result.LastInsertId()
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "unable to register user")
-		return
+func (a *app) requireAdminSecret(
+	next func(http.ResponseWriter, *http.Request),
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.adminSecretOn || !a.hasAdminSecret(r) {
+			writeError(w, http.StatusUnauthorized, codeAdminUnauthorized, "admin authorization failed")
+			return
+		}
+
+		next(w, r)
 	}
+}
 
-	writeJSON(w, http.StatusCreated, map[string]string{
-		"id":        strconv.FormatInt(userID, 10),
-		"email":     email,
-		"createdAt": createdAt,
-	})
+func (a *app) requireAdmin(
+	next func(http.ResponseWriter, *http.Request),
+) http.HandlerFunc {
+	secretFallback := a.requireAdminSecret(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if user, err := a.userFromRequest(r); err == nil && user.IsAdmin {
+			next(w, r)
+			return
+		}
+
+		secretFallback(w, r)
+	}
 }
 
-func (a *app) handleLogin(w http.ResponseWriter, r *http.Request) {
-	var req loginRequest
-	if err := decodeJSON(r, &req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid JSON payload")
-		return
+func (a *app) hasAdminSecret(r *http.Request) bool {
+	adminSecret := strings.TrimSpace(r.Header.Get("X-Admin-Secret"))
+	if adminSecret == "" {
+		authHeader := strings.TrimSpace(r.Header.Get("Authorization"))
+		if strings.HasPrefix(authHeader, "Bearer ") {
+			adminSecret = strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
+		}
 	}
 
-	email := strings.TrimSpace(strings.ToLower(req.Email))
-	if !emailRegex.MatchString(email) {
-		writeError(w, http.StatusBadRequest, "email is invalid")
-		return
+	if adminSecret == "" {
+		return false
 	}
 
-	user, err := a.findUserByEmail(r.Context(), email)
+	matched := 0
+	for _, secret := range a.adminSecrets {
+		matched |= subtle.ConstantTimeCompare([]byte(adminSecret), []byte(secret))
+	}
+	return matched == 1
+}
+
+func (a *app) userFromRequest(r *http.Request) (userRecord, error) {
+	var tokenString string
+	authHeader := strings.TrimSpace(r.Header.Get("Authorization"))
+	if authHeader == "" {
+		cookie, err := r.Cookie(authCookieName)
+		if err != nil || cookie.Value == "" {
+			return userRecord{}, errors.New("missing authorization header")
+		}
+		tokenString = cookie.Value
+	} else {
+		const bearerPrefix = "Bearer "
+		if !strings.HasPrefix(authHeader, bearerPrefix) {
+			return userRecord{}, errors.New("invalid authorization header")
+		}
+		tokenString = strings.TrimSpace(strings.TrimPrefix(authHeader, bearerPrefix))
+		if tokenString == "" {
+			return userRecord{}, errors.New("invalid authorization header")
+		}
+	}
+
+	token, err := jwt.ParseWithClaims(tokenString, &authClaims{}, func(t *jwt.Token) (interface{}, error) {
+		if a.jwtPublicKey != nil {
+			if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+				return nil, errors.New("unexpected signing method")
+			}
+			return a.jwtPublicKey, nil
+		}
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return a.jwtSecret, nil
+	})
 	if err != nil {
-		writeError(w, http.StatusUnauthorized, "invalid credentials")
-		return
+		return userRecord{}, err
 	}
 
-	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)) != nil {
-		writeError(w, http.StatusUnauthorized, "invalid credentials")
-		return
+	claims, ok := token.Claims.(*authClaims)
+	if !ok || !token.Valid {
+		return userRecord{}, errors.New("invalid token")
 	}
 
-	token, err := a.signToken(user)
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil || userID <= 0 {
+		return userRecord{}, errors.New("invalid token subject")
+	}
+
+	user, err := a.findUserByID(r.Context(), userID)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "unable to create token")
-		return
+		return userRecord{}, err
 	}
 
-	writeJSON(w, http.StatusOK, map[string]string{"token": token})
+	if user.TokensInvalidBefore.Valid {
+		invalidBefore, err := time.Parse(time.RFC3339, user.TokensInvalidBefore.String)
+		if err != nil {
+			return userRecord{}, err
+		}
+		if claims.IssuedAt == nil || !claims.IssuedAt.Time.After(invalidBefore) {
+			return userRecord{}, errors.New("token has been revoked")
+		}
+	}
+	return user, nil
 }
 
-func (a *app) handleMe(w http.ResponseWriter, _ *http.Request, user userRecord) {
-	writeJSON(w, http.StatusOK, map[string]string{
-		"id":    strconv.FormatInt(user.ID, 10),
-		"email": user.Email,
-	})
+func (a *app) signToken(user userRecord) (string, error) {
+	now := time.Now().UTC()
+	claims := authClaims{
+		Email: user.Email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(tokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Subject:   strconv.FormatInt(user.ID, 10),
+		},
+	}
+	if a.jwtPrivateKey != nil {
+		return jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(a.jwtPrivateKey)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(a.jwtSecret)
 }
 
-func (a *app) handleCreateDesign(w http.ResponseWriter, r *http.Request, user userRecord) {
-	var req designUpsertRequest
-	if err := decodeJSON(r, &req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid JSON payload")
-		return
+func (a *app) recordLoginAttempt(r *http.Request, email string, success bool) {
+	_, err := a.db.ExecContext(
+		r.Context(),
+		`INSERT INTO login_attempts(email, ip, success, created_at) VALUES (?, ?, ?, ?)`,
+		email,
+		a.clientIP(r),
+		success,
+		time.Now().UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		log.Printf("record login attempt for %s: %v", email, err)
 	}
+}
 
-	selections, err := validateSelections(req.Selections)
+func (a *app) rehashPassword(ctx context.Context, userID int64, password string) error {
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), a.bcryptCost)
 	if err != nil {
-		writeError(w, http.StatusBadRequest, err.Error())
-		return
+		return err
 	}
 
-	name := strings.TrimSpace(req.Name)
-	if name == "" {
-		name = fmt.Sprintf("Design %d", time.Now().UTC().Unix())
+	_, err = a.db.ExecContext(ctx, `UPDATE users SET password_hash = ? WHERE id = ?`, string(passwordHash), userID)
+	return err
+}
+
+func (a *app) normalizeEmail(email string) string {
+	if !a.normalizePlus {
+		return email
 	}
 
-	selectionsJSON, err := json.Marshal(selections)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "unable to encode design selections")
-		return
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || !plusAddressingDomains[domain] {
+		return email
 	}
+	local, _, _ = strings.Cut(local, "+")
+	return local + "@" + domain
+}
 
-	now := time.Now().UTC().Format(time.RFC3339)
-	result, err := a.db.ExecContext(
-		r.Context(),
-		`INSERT INTO designs(user_id, name, selections_json, status, rejection_reason, created_at, updated_at) VALUES (?, ?, ?, ?, NULL, ?, ?)`,
-		user.ID,
-		name,
-		string(selectionsJSON),
-		string(statusDraft),
-		now,
-		now,
-	)
+func (a *app) normalizedEmailTaken(ctx context.Context, normalizedEmail string, excludeUserID int64) (bool, error) {
+	if !a.normalizePlus {
+		return false, nil
+	}
+
+	var exists bool
+	err := a.db.QueryRowContext(
+		ctx,
+		`SELECT EXISTS(SELECT 1 FROM users WHERE normalized_email = ? AND id != ?)`,
+		normalizedEmail,
+		excludeUserID,
+	).Scan(&exists)
+	return exists, err
+}
+
+func (a *app) findUserByEmail(ctx context.Context, email string) (userRecord, error) {
+	var user userRecord
+	err := a.db.QueryRowContext(
+		ctx,
+		`SELECT id, email, password_hash, is_admin, last_login_at, tokens_invalid_before FROM users WHERE email = ?`,
+		email,
+	).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.IsAdmin, &user.LastLoginAt, &user.TokensInvalidBefore)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "unable to save design")
-		return
+		return userRecord{}, err
 	}
+	return user, nil
+}
 
-	insertID, err := result.LastInsertId()
+func (a *app) findUserByID(ctx context.Context, userID int64) (userRecord, error) {
+	var user userRecord
+	err := a.db.QueryRowContext(
+		ctx,
+		`SELECT id, email, password_hash, is_admin, last_login_at, tokens_invalid_before FROM users WHERE id = ?`,
+		userID,
+	).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.IsAdmin, &user.LastLoginAt, &user.TokensInvalidBefore)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "unable to save design")
-		return
+		return userRecord{}, err
+	}
+	return user, nil
+}
+
+func (p passwordPolicy) validatePassword(password string) error {
+	if utf8.RuneCountInString(password) < p.minLength {
+		return fmt.Errorf("password must be at least %d characters", p.minLength)
+	}
+	if !p.requireMixed {
+		return nil
+	}
+
+	hasLetter := false
+	hasDigit := false
+	for _, char := range password {
+		switch {
+		case unicode.IsLetter(char):
+			hasLetter = true
+		case unicode.IsDigit(char):
+			hasDigit = true
+		}
+	}
+
+	if !hasLetter {
+		return errors.New("password must contain at least one letter")
+	}
+	if !hasDigit {
+		return errors.New("password must contain at least one digit")
+	}
+	return nil
+}
+
+func (m catalogMaterial) finishes() []string {
+	if len(m.AllowedFinishes) > 0 {
+		return m.AllowedFinishes
 	}
+	return defaultCatalog.AllowedFinishes
+}
+
+func (m catalogMaterial) patternIDs() []string {
+	if len(m.AllowedPatternIDs) > 0 {
+		return m.AllowedPatternIDs
+	}
+	return defaultCatalog.AllowedPatternIDs
+}
+
+func findCatalogMaterial(key string) (catalogMaterial, bool) {
+	for _, material := range defaultCatalog.Materials {
+		if material.Key == key {
+			return material, true
+		}
+	}
+	return catalogMaterial{}, false
+}
 
-	record := designRecord{
-		CreatedAt:  now,
-		ID:         strconv.FormatInt(insertID, 10),
-		Materials:  selections,
-		Name:       name,
-		Status:     statusDraft,
-		UpdatedAt:  now,
-		UserID:     user.ID,
-		DatabaseID: insertID,
+func (m catalogMaterial) defaultColor() string {
+	switch {
+	case m.DefaultColorHex != "":
+		return strings.ToUpper(m.DefaultColorHex)
+	case len(m.AllowedColors) > 0:
+		return m.AllowedColors[0]
+	default:
+		return defaultColorHex
 	}
-	writeJSON(w, http.StatusCreated, record)
 }
 
-func (a *app) handleListDesigns(w http.ResponseWriter, r *http.Request, user userRecord) {
-	rows, err := a.db.QueryContext(
-		r.Context(),
-		`SELECT id, name, selections_json, status, rejection_reason, created_at, updated_at FROM designs WHERE user_id = ? ORDER BY created_at DESC`,
-		user.ID,
-	)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "unable to load designs")
-		return
+func (m catalogMaterial) defaultSelection() materialSelection {
+	selection := materialSelection{ColorHex: m.defaultColor(), Finish: m.finishes()[0], PatternID: m.patternIDs()[0]}
+	if slices.Contains(m.patternIDs(), "NONE") {
+		selection.PatternID = "NONE"
 	}
-	defer rows.Close()
+	return selection
+}
 
-	designs := make([]designRecord, 0)
-	for rows.Next() {
-		var (
-			id              int64
-			name            string
-			selectionsJSON  string
-			statusValue     string
-			rejectionReason sql.NullString
-			createdAt       string
-			updatedAt       string
-		)
+func validateSelections(
+	selections map[string]materialSelection,
+) (map[string]materialSelection, error) {
+	if len(selections) == 0 {
+		return nil, &codedError{codeSelectionsRequired, "selections must include at least one material"}
+	}
 
-		if err := rows.Scan(&id, &name, &selectionsJSON, &statusValue, &rejectionReason, &createdAt, &updatedAt); err != nil {
-			writeError(w, http.StatusInternalServerError, "unable to load designs")
-			return
+	normalizedKeys := make(map[string]string, len(selections))
+	for _, key := range sortedSelectionKeys(selections) {
+		normalized := normalizeMaterialName(key)
+		if existing, ok := normalizedKeys[normalized]; ok {
+			return nil, &codedError{codeDuplicateMaterial, fmt.Sprintf("material keys %q and %q refer to the same material", existing, key)}
 		}
+		normalizedKeys[normalized] = key
+	}
 
-		selections := map[string]materialSelection{}
-		if err := json.Unmarshal([]byte(selectionsJSON), &selections); err != nil {
-			writeError(w, http.StatusInternalServerError, "corrupt design data")
-			return
+	namedColors := map[string]string{}
+	for _, named := range defaultCatalog.NamedColors {
+		namedColors[named.Name] = named.Hex
+	}
+
+	validated := make(map[string]materialSelection, len(selections))
+	for key, value := range selections {
+		material, ok := findCatalogMaterial(key)
+		if !ok {
+			return nil, &codedError{codeInvalidMaterial, fmt.Sprintf("material key %q is not allowed", key)}
 		}
 
-		record := designRecord{
-			CreatedAt:  createdAt,
-			ID:         strconv.FormatInt(id, 10),
-			Materials:  selections,
-			Name:       name,
-			Status:     designStatus(statusValue),
-			UpdatedAt:  updatedAt,
-			UserID:     user.ID,
-			DatabaseID: id,
+		color := strings.ToUpper(strings.TrimSpace(value.ColorHex))
+		if color != "" && !strings.HasPrefix(color, "#") {
+			hex, ok := namedColors[normalizeColorName(color)]
+			if !ok {
+				return nil, &codedError{codeInvalidColor, fmt.Sprintf("material %q has unknown color name %q", key, value.ColorHex)}
+			}
+			color = hex
 		}
-		if rejectionReason.Valid {
-			reason := rejectionReason.String
-			record.RejectionReason = &reason
+		if !hexRegex.MatchString(color) {
+			return nil, &codedError{codeInvalidColor, fmt.Sprintf("material %q has invalid colorHex", key)}
+		}
+		if len(material.AllowedColors) > 0 && !containsFold(material.AllowedColors, color) {
+			return nil, &codedError{codeColorNotAllowed, fmt.Sprintf("material %q does not allow color %s", key, color)}
+		}
+		finish := strings.ToUpper(strings.TrimSpace(value.Finish))
+		if !containsFold(material.finishes(), finish) {
+			return nil, &codedError{codeInvalidFinish, fmt.Sprintf("material %q has invalid finish", key)}
+		}
+		patternID := strings.ToUpper(strings.TrimSpace(value.PatternID))
+		if !containsFold(material.patternIDs(), patternID) {
+			return nil, &codedError{codeInvalidPattern, fmt.Sprintf("material %q has invalid patternId", key)}
 		}
 
-		designs = append(designs, record)
-	}
-
-	if err := rows.Err(); err != nil {
-		writeError(w, http.StatusInternalServerError, "unable to load designs")
-		return
+		validated[key] = materialSelection{
+			ColorHex:  color,
+			Finish:    finish,
+			PatternID: patternID,
+		}
 	}
 
-	writeJSON(w, http.StatusOK, map[string][]designRecord{
-		"designs": designs,
-	})
+	return validated, nil
 }
 
-func (a *app) handleGetDesign(w http.ResponseWriter, r *http.Request, user userRecord) {
-	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
-	if err != nil || id <= 0 {
-		writeError(w, http.StatusBadRequest, "design id is invalid")
-		return
-	}
-
-	record, err := a.findDesignByID(r.Context(), id)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			writeError(w, http.StatusNotFound, "design not found")
-			return
+func negotiateExportFormat(r *http.Request) (string, bool) {
+	if format := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format"))); format != "" {
+		switch format {
+		case "json", "csv", "pdf":
+			return format, true
 		}
-		writeError(w, http.StatusInternalServerError, "unable to load design")
-		return
+		return "", false
 	}
 
-	if record.UserID != user.ID {
-		writeError(w, http.StatusNotFound, "design not found")
-		return
+	accept := strings.TrimSpace(r.Header.Get("Accept"))
+	if accept == "" {
+		return "json", true
 	}
 
-	writeJSON(w, http.StatusOK, record)
+	best, bestQuality := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(part, ";")
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(name), "q") {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				parsed = 0
+			}
+			quality = parsed
+		}
+
+		format := ""
+		switch strings.ToLower(strings.TrimSpace(mediaType)) {
+		case "application/json", "application/*", "*/*":
+			format = "json"
+		case "text/csv", "text/*":
+			format = "csv"
+		case "application/pdf":
+			format = "pdf"
+		}
+		if format != "" && quality > bestQuality {
+			best, bestQuality = format, quality
+		}
+	}
+	return best, best != ""
 }
 
-func (a *app) handleUpdateDesign(w http.ResponseWriter, r *http.Request, user userRecord) {
-	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
-	if err != nil || id <= 0 {
-		writeError(w, http.StatusBadRequest, "design id is invalid")
-		return
+func sortedSelectionKeys(selections map[string]materialSelection) []string {
+	keys := make([]string, 0, len(selections))
+	for key := range selections {
+		keys = append(keys, key)
 	}
+	sort.Strings(keys)
+	return keys
+}
 
-	existing, err := a.findDesignByID(r.Context(), id)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			writeError(w, http.StatusNotFound, "design not found")
-			return
+func catalogMaterialName(key string) string {
+	for _, material := range defaultCatalog.Materials {
+		if material.Key == key {
+			return material.Name
 		}
-		writeError(w, http.StatusInternalServerError, "unable to load design")
-		return
 	}
+	return key
+}
 
-	if existing.UserID != user.ID {
-		writeError(w, http.StatusNotFound, "design not found")
-		return
+func renderDesignPDF(record designRecord) ([]byte, error) {
+	pdf := fpdf.New("P", "pt", "Letter", "")
+	pdf.SetMargins(50, 50, 50)
+	pdf.SetTitle(record.Name, true)
+	pdf.AddPage()
+	translate := pdf.UnicodeTranslatorFromDescriptor("")
+
+	pdf.SetFont("Helvetica", "B", 20)
+	pdf.CellFormat(0, 28, translate(record.Name), "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 11)
+	for _, line := range []string{
+		"Status: " + string(record.Status),
+		"Created: " + record.CreatedAt,
+		"Updated: " + record.UpdatedAt,
+	} {
+		pdf.CellFormat(0, 16, line, "", 1, "L", false, 0, "")
 	}
+	pdf.Ln(16)
 
-	var req designUpsertRequest
-	if err := decodeJSON(r, &req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid JSON payload")
-		return
+	widths := []float64{200, 110, 80, 120}
+	pdf.SetFont("Helvetica", "B", 12)
+	for i, header := range []string{"Material", "Color", "Finish", "Pattern"} {
+		pdf.CellFormat(widths[i], 20, header, "B", 0, "L", false, 0, "")
 	}
+	pdf.Ln(-1)
 
-	selections, err := validateSelections(req.Selections)
-	if err != nil {
-		writeError(w, http.StatusBadRequest, err.Error())
-		return
+	pdf.SetFont("Helvetica", "", 11)
+	for _, key := range sortedSelectionKeys(record.Materials) {
+		selection := record.Materials[key]
+		for i, value := range []string{catalogMaterialName(key), selection.ColorHex, selection.Finish, selection.PatternID} {
+			pdf.CellFormat(widths[i], 18, translate(value), "", 0, "L", false, 0, "")
+		}
+		pdf.Ln(-1)
 	}
 
-	name := strings.TrimSpace(req.Name)
-	if name == "" {
-		name = existing.Name
+	var out bytes.Buffer
+	if err := pdf.Output(&out); err != nil {
+		return nil, err
 	}
+	return out.Bytes(), nil
+}
 
-	selectionsJSON, err := json.Marshal(selections)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "unable to encode design selections")
-		return
+func diffSelections(left, right map[string]materialSelection) []materialDiff {
+	keys := make([]string, 0, len(left)+len(right))
+	for key := range left {
+		keys = append(keys, key)
 	}
-
-	updatedAt := time.Now().UTC().Format(time.RFC3339)
-	_, err = a.db.ExecContext(
-		r.Context(),
-		`UPDATE designs SET name = ?, selections_json = ?, status = ?, rejection_reason = NULL, updated_at = ? WHERE id = ? AND user_id = ?`,
-		name,
-		string(selectionsJSON),
-		string(statusDraft),
-		updatedAt,
-		id,
-		user.ID,
-	)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "unable to update design")
-		return
+	for key := range right {
+		if _, ok := left[key]; !ok {
+			keys = append(keys, key)
+		}
 	}
+	sort.Strings(keys)
 
-	writeJSON(w, http.StatusOK, designRecord{
-		CreatedAt:  existing.CreatedAt,
-		ID:         strconv.FormatInt(id, 10),
-		Materials:  selections,
-		Name:       name,
-		Status:     statusDraft,
-		UpdatedAt:  updatedAt,
-		UserID:     user.ID,
-		DatabaseID: id,
-	})
-}
+	diffs := make([]materialDiff, 0)
+	for _, key := range keys {
+		leftValue, leftOK := left[key]
+		rightValue, rightOK := right[key]
 
-func (a *app) handleSubmitDesign(w http.ResponseWriter, r *http.Request, user userRecord) {
-	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
-	if err != nil || id <= 0 {
-		writeError(w, http.StatusBadRequest, "design id is invalid")
-		return
+		diff := materialDiff{ChangedFields: []string{}, Key: key}
+		if leftOK {
+			diff.Left = &leftValue
+		}
+		if rightOK {
+			diff.Right = &rightValue
+		}
+
+		if leftOK != rightOK || leftValue.ColorHex != rightValue.ColorHex {
+			diff.ChangedFields = append(diff.ChangedFields, "colorHex")
+		}
+		if leftOK != rightOK || leftValue.Finish != rightValue.Finish {
+			diff.ChangedFields = append(diff.ChangedFields, "finish")
+		}
+		if leftOK != rightOK || leftValue.PatternID != rightValue.PatternID {
+			diff.ChangedFields = append(diff.ChangedFields, "patternId")
+		}
+
+		if len(diff.ChangedFields) > 0 {
+			diffs = append(diffs, diff)
+		}
 	}
+	return diffs
+}
 
-	record, err := a.findDesignByID(r.Context(), id)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			writeError(w, http.StatusNotFound, "design not found")
-			return
+func (a *app) validateName(name string) error {
+	if utf8.RuneCountInString(name) > a.maxNameLength {
+		return fmt.Errorf("name must be at most %d characters", a.maxNameLength)
+	}
+	for _, char := range name {
+		if unicode.IsControl(char) {
+			return errors.New("name must not contain control characters")
 		}
-		writeError(w, http.StatusInternalServerError, "unable to load design")
-		return
 	}
+	return nil
+}
 
-	if record.UserID != user.ID {
-		writeError(w, http.StatusNotFound, "design not found")
-		return
+func (a *app) submissionProblems(selections map[string]materialSelection) []string {
+	problems := submissionProblems(selections)
+	if !a.currentSettings().RequireFullSelection {
+		return problems
 	}
 
-	if record.Status == statusSubmitted {
-		writeError(w, http.StatusConflict, "design is already submitted")
-		return
+	missing := make([]string, 0)
+	for _, material := range defaultCatalog.Materials {
+		if _, ok := selections[material.Key]; !ok {
+			missing = append(missing, material.Key)
+		}
 	}
-	if record.Status == statusApproved {
-		writeError(w, http.StatusConflict, "approved designs cannot be re-submitted")
-		return
+	if len(missing) > 0 {
+		problems = append(problems, "submission requires a selection for every material (missing "+strings.Join(missing, ", ")+")")
 	}
+	return problems
+}
 
-	if err := validateSubmissionSelections(record.Materials); err != nil {
-		writeError(w, http.StatusBadRequest, err.Error())
-		return
+func checkSelectionWarnings(selections map[string]materialSelection) []string {
+	warnings := submissionProblems(selections)
+
+	bodyPaint, hasBodyPaint := selections["material_9"]
+	glass, hasGlass := selections["material_3"]
+	if hasBodyPaint && hasGlass && colorDistance(bodyPaint.ColorHex, glass.ColorHex) < lowContrastDistance {
+		warnings = append(warnings, "Body_Paint and Glass colors are nearly identical")
 	}
+	return warnings
+}
 
-	updatedRecord, err := a.setDesignStatus(
-		r.Context(),
-		id,
-		statusSubmitted,
-		nil,
-	)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "unable to submit design")
-		return
+func colorDistance(a, b string) float64 {
+	first, okA := parseHexColor(a)
+	second, okB := parseHexColor(b)
+	if !okA || !okB {
+		return math.MaxFloat64
 	}
 
-	writeJSON(w, http.StatusOK, updatedRecord)
+	var sum float64
+	for i := range first {
+		delta := first[i] - second[i]
+		sum += delta * delta
+	}
+	return math.Sqrt(sum)
 }
 
-func (a *app) handleAdminListSubmissions(w http.ResponseWriter, r *http.Request) {
-	rows, err := a.db.QueryContext(
-		r.Context(),
-		`SELECT d.id, d.user_id, u.email, d.name, d.selections_json, d.status, d.rejection_reason, d.created_at, d.updated_at
-		 FROM designs d
-		 JOIN users u ON u.id = d.user_id
-		 WHERE d.status = ?
-		 ORDER BY d.updated_at DESC`,
-		string(statusSubmitted),
-	)
+func parseHexColor(value string) ([3]float64, bool) {
+	if !hexRegex.MatchString(value) {
+		return [3]float64{}, false
+	}
+	decoded, err := hex.DecodeString(value[1:])
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "unable to load submissions")
-		return
+		return [3]float64{}, false
 	}
-	defer rows.Close()
-
-	submissions := make([]adminSubmissionRecord, 0)
-	for rows.Next() {
-		var (
-			id              int64
-			userID          int64
-			userEmail       string
-			name            string
-			selectionsJSON  string
-			statusValue     string
-			rejectionReason sql.NullString
-			createdAt       string
-			updatedAt       string
-		)
-		if err := rows.Scan(&id, &userID, &userEmail, &name, &selectionsJSON, &statusValue, &rejectionReason, &createdAt, &updatedAt); err != nil {
-			writeError(w, http.StatusInternalServerError, "unable to load submissions")
-			return
-		}
+	return [3]float64{float64(decoded[0]), float64(decoded[1]), float64(decoded[2])}, true
+}
 
-		selections := map[string]materialSelection{}
-		if err := json.Unmarshal([]byte(selectionsJSON), &selections); err != nil {
-			writeError(w, http.StatusInternalServerError, "corrupt design data")
-			return
+func relativeLuminance(rgb [3]float64) float64 {
+	var linear [3]float64
+	for i, channel := range rgb {
+		c := channel / 255
+		if c <= 0.03928 {
+			linear[i] = c / 12.92
+		} else {
+			linear[i] = math.Pow((c+0.055)/1.055, 2.4)
 		}
+	}
+	return 0.2126*linear[0] + 0.7152*linear[1] + 0.0722*linear[2]
+}
 
-		record := adminSubmissionRecord{
-			CreatedAt: createdAt,
-			ID:        strconv.FormatInt(id, 10),
-			Materials: selections,
-			Name:      name,
-			Status:    designStatus(statusValue),
-			UpdatedAt: updatedAt,
-			UserEmail: userEmail,
-			UserID:    strconv.FormatInt(userID, 10),
-		}
-		if rejectionReason.Valid {
-			reason := rejectionReason.String
-			record.RejectionReason = &reason
-		}
-		submissions = append(submissions, record)
+func contrastRatio(a, b string) (float64, bool) {
+	first, okA := parseHexColor(a)
+	second, okB := parseHexColor(b)
+	if !okA || !okB {
+		return 0, false
 	}
 
-	if err := rows.Err(); err != nil {
-		writeError(w, http.StatusInternalServerError, "unable to load submissions")
-		return
+	lighter := relativeLuminance(first)
+	darker := relativeLuminance(second)
+	if darker > lighter {
+		lighter, darker = darker, lighter
 	}
+	return (lighter + 0.05) / (darker + 0.05), true
+}
 
-	writeJSON(w, http.StatusOK, map[string][]adminSubmissionRecord{
-		"designs": submissions,
-	})
+func submissionWarnings(selections map[string]materialSelection) []string {
+	warnings := make([]string, 0)
+
+	bodyPaint, hasBodyPaint := selections["material_9"]
+	frames, hasFrames := selections["material_5"]
+	if hasBodyPaint && hasFrames {
+		if ratio, ok := contrastRatio(bodyPaint.ColorHex, frames.ColorHex); ok && ratio < minFrameContrast {
+			warnings = append(warnings, fmt.Sprintf(
+				"Body_Paint and Window & Door Frames have low contrast (%.2f:1, recommended at least %.1f:1)",
+				ratio,
+				minFrameContrast,
+			))
+		}
+	}
+	return warnings
 }
 
-func (a *app) handleAdminApproveDesign(w http.ResponseWriter, r *http.Request) {
-	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
-	if err != nil || id <= 0 {
-		writeError(w, http.StatusBadRequest, "design id is invalid")
-		return
+func submissionProblems(selections map[string]materialSelection) []string {
+	hasBodyPaint := false
+	hasGlass := false
+	problems := make([]string, 0)
+
+	keys := make([]string, 0, len(selections))
+	for key := range selections {
+		keys = append(keys, key)
 	}
+	sort.Strings(keys)
 
-	record, err := a.findDesignByID(r.Context(), id)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			writeError(w, http.StatusNotFound, "design not found")
-			return
+	for _, key := range keys {
+		normalizedKey := normalizeMaterialName(key)
+		switch normalizedKey {
+		case "material_9", "bodypaint", "body_paint":
+			hasBodyPaint = true
+			if !hasChosenColor(key, selections[key]) {
+				problems = append(problems, "Body_Paint selection must set a color before submission")
+			}
+		case "material_3", "glass", "glassset", "glass_set":
+			hasGlass = true
+			if !hasChosenColor(key, selections[key]) {
+				problems = append(problems, "Glass selection must set a color before submission")
+			}
+			if strings.ToUpper(strings.TrimSpace(selections[key].PatternID)) != "NONE" {
+				problems = append(problems, "Glass selection must use patternId NONE before submission")
+			}
 		}
-		writeError(w, http.StatusInternalServerError, "unable to load design")
-		return
 	}
-	if record.Status != statusSubmitted {
-		writeError(w, http.StatusConflict, "only submitted designs can be approved")
-		return
+
+	if !hasBodyPaint {
+		problems = append(problems, "submission requires a Body_Paint selection")
+	}
+	if !hasGlass {
+		problems = append(problems, "submission requires a Glass selection")
 	}
+	return problems
+}
 
-	updatedRecord, err := a.setDesignStatus(r.Context(), id, statusApproved, nil)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "unable to approve design")
-		return
+func hasChosenColor(key string, selection materialSelection) bool {
+	unset := defaultColorHex
+	if material, ok := findCatalogMaterial(key); ok {
+		unset = material.defaultColor()
 	}
 
-	writeJSON(w, http.StatusOK, updatedRecord)
+	colorHex := strings.TrimSpace(selection.ColorHex)
+	return colorHex != "" && !strings.EqualFold(colorHex, unset)
 }
 
-func (a *app) handleAdminRejectDesign(w http.ResponseWriter, r *http.Request) {
-	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
-	if err != nil || id <= 0 {
-		writeError(w, http.StatusBadRequest, "design id is invalid")
-		return
+func topOptionCounts(counts map[string]int, limit int) []optionCount {
+	result := make([]optionCount, 0, len(counts))
+	for value, count := range counts {
+		result = append(result, optionCount{Count: count, Value: value})
 	}
 
-	record, err := a.findDesignByID(r.Context(), id)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			writeError(w, http.StatusNotFound, "design not found")
-			return
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
 		}
-		writeError(w, http.StatusInternalServerError, "unable to load design")
-		return
-	}
-	if record.Status != statusSubmitted {
-		writeError(w, http.StatusConflict, "only submitted designs can be rejected")
-		return
-	}
+		return result[i].Value < result[j].Value
+	})
 
-	var req rejectRequest
-	if err := decodeJSON(r, &req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid JSON payload")
-		return
-	}
-	reason := strings.TrimSpace(req.Reason)
-	if reason == "" {
-		writeError(w, http.StatusBadRequest, "rejection reason is required")
-		return
+	if len(result) > limit {
+		result = result[:limit]
 	}
+	return result
+}
 
-	updatedRecord, err := a.setDesignStatus(r.Context(), id, statusRejected, &reason)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "unable to reject design")
-		return
+func parsePagination(r *http.Request) (int, int, error) {
+	query := r.URL.Query()
+
+	limit := defaultPageLimit
+	if raw := strings.TrimSpace(query.Get("limit")); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			return 0, 0, errors.New("limit must be a positive integer")
+		}
+		limit = min(parsed, maxPageLimit)
+	}
+
+	offset := 0
+	if raw := strings.TrimSpace(query.Get("offset")); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 0 {
+			return 0, 0, errors.New("offset must be a non-negative integer")
+		}
+		offset = parsed
 	}
 
-	writeJSON(w, http.StatusOK, updatedRecord)
+	return limit, offset, nil
 }
 
-func (a *app) setDesignStatus(
-	ctx context.Context,
-	id int64,
-	status designStatus,
-	rejectionReason *string,
-) (designRecord, error) {
-	updatedAt := time.Now().UTC().Format(time.RFC3339)
-	if rejectionReason == nil {
-		_, err := a.db.ExecContext(
-			ctx,
-			`UPDATE designs SET status = ?, rejection_reason = NULL, updated_at = ? WHERE id = ?`,
-			string(status),
-			updatedAt,
-			id,
-		)
-		if err != nil {
-			return designRecord{}, err
+func parseTimeRange(query url.Values, column, afterParam, beforeParam string) ([]string, []interface{}, error) {
+	conditions := make([]string, 0, 2)
+	args := make([]interface{}, 0, 2)
+	for _, bound := range []struct {
+		param    string
+		operator string
+	}{
+		{afterParam, ">="},
+		{beforeParam, "<"},
+	} {
+		raw := strings.TrimSpace(query.Get(bound.param))
+		if raw == "" {
+			continue
 		}
-	} else {
-		_, err := a.db.ExecContext(
-			ctx,
-			`UPDATE designs SET status = ?, rejection_reason = ?, updated_at = ? WHERE id = ?`,
-			string(status),
-			*rejectionReason,
-			updatedAt,
-			id,
-		)
+		parsed, err := time.Parse(time.RFC3339, raw)
 		if err != nil {
-			return designRecord{}, err
+			return nil, nil, fmt.Errorf("%s must be an RFC3339 timestamp", bound.param)
 		}
+		conditions = append(conditions, column+" "+bound.operator+" ?")
+		args = append(args, parsed.UTC().Format(time.RFC3339))
 	}
-
-	return a.findDesignByID(ctx, id)
+	return conditions, args, nil
 }
 
-func (a *app) findDesignByID(ctx context.Context, id int64) (designRecord, error) {
-	var (
-		record          designRecord
-		userID          int64
-		designName      string
-		selectionsJSON  string
-		statusValue     string
-		rejectionReason sql.NullString
-		createdAt       string
-		updatedAt       string
-	)
+func setPaginationHeaders(w http.ResponseWriter, r *http.Request, total, limit, offset int) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
 
-	err := a.db.QueryRowContext(
-		ctx,
-		`SELECT id, user_id, name, selections_json, status, rejection_reason, created_at, updated_at FROM designs WHERE id = ?`,
-		id,
-	).Scan(
-		&record.DatabaseID,
-		&userID,
-		&designName,
-		&selectionsJSON,
-		&statusValue,
-		&rejectionReason,
-		&createdAt,
-		&updatedAt,
-	)
-	if err != nil {
-		return designRecord{}, err
+	links := make([]string, 0, 2)
+	if offset+limit < total {
+		links = append(links, pageLink(r, "next", map[string]string{
+			"limit":  strconv.Itoa(limit),
+			"offset": strconv.Itoa(offset + limit),
+		}))
 	}
-
-	selections := map[string]materialSelection{}
-	if err := json.Unmarshal([]byte(selectionsJSON), &selections); err != nil {
-		return designRecord{}, err
+	if offset > 0 {
+		links = append(links, pageLink(r, "prev", map[string]string{
+			"limit":  strconv.Itoa(limit),
+			"offset": strconv.Itoa(max(offset-limit, 0)),
+		}))
 	}
-
-	record.CreatedAt = createdAt
-	record.ID = strconv.FormatInt(id, 10)
-	record.Materials = selections
-	record.Name = designName
-	record.Status = designStatus(statusValue)
-	record.UpdatedAt = updatedAt
-	record.UserID = userID
-	if rejectionReason.Valid {
-		reason := rejectionReason.String
-		record.RejectionReason = &reason
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
 	}
-	return record, nil
 }
 
-func (a *app) requireAuth(
-	next func(http.ResponseWriter, *http.Request, userRecord),
-) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		user, err := a.userFromRequest(r)
-		if err != nil {
-			writeError(w, http.StatusUnauthorized, "unauthorized")
-			return
+func pageLink(r *http.Request, rel string, params map[string]string) string {
+	query := r.URL.Query()
+	for key, value := range params {
+		if value == "" {
+			query.Del(key)
+			continue
 		}
-		next(w, r, user)
+		query.Set(key, value)
 	}
+	target := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	return fmt.Sprintf(`<%s>; rel="%s"`, target.String(), rel)
 }
 
-func (a *app) requireAdminSecret(
-	next func(http.ResponseWriter, *http.Request),
-) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		adminSecret := strings.TrimSpace(r.Header.Get("X-Admin-Secret"))
-		if adminSecret == "" {
-			authHeader := strings.TrimSpace(r.Header.Get("Authorization"))
-			if strings.HasPrefix(authHeader, "Bearer ") {
-				adminSecret = strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
-			}
+func normalizeTimestamp(value string) (string, error) {
+	trimmed := strings.TrimSpace(value)
+	for _, layout := range timestampLayouts {
+		parsed, err := time.Parse(layout, trimmed)
+		if err == nil {
+			return parsed.UTC().Format(time.RFC3339), nil
 		}
+	}
+	return "", fmt.Errorf("unrecognized timestamp %q", value)
+}
 
-		if adminSecret == "" || adminSecret != a.adminSecret {
-			writeError(w, http.StatusUnauthorized, "admin authorization failed")
-			return
-		}
+func parseDesignCursor(param, value string) (string, int64, error) {
+	createdAt, rawID, ok := strings.Cut(value, ",")
+	if !ok {
+		return "", 0, fmt.Errorf("%s cursor must be <createdAt>,<id>", param)
+	}
+	if _, err := time.Parse(time.RFC3339, createdAt); err != nil {
+		return "", 0, fmt.Errorf("%s cursor has an invalid createdAt", param)
+	}
+	id, err := strconv.ParseInt(rawID, 10, 64)
+	if err != nil || id <= 0 {
+		return "", 0, fmt.Errorf("%s cursor has an invalid id", param)
+	}
+	return createdAt, id, nil
+}
 
-		next(w, r)
+func parseDesignStatus(value string) (designStatus, bool) {
+	status := designStatus(strings.ToUpper(strings.TrimSpace(value)))
+	switch status {
+	case statusApproved, statusDraft, statusRejected, statusSubmitted:
+		return status, true
 	}
+	return "", false
 }
 
-func (a *app) userFromRequest(r *http.Request) (userRecord, error) {
-	authHeader := strings.TrimSpace(r.Header.Get("Authorization"))
-	if authHeader == "" {
-		return userRecord{}, errors.New("missing authorization header")
+func containsFold(values []string, target string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, target) {
+			return true
+		}
 	}
+	return false
+}
+
+func normalizeColorName(value string) string {
+	upper := strings.ToUpper(strings.TrimSpace(value))
+	upper = strings.ReplaceAll(upper, "-", "_")
+	upper = strings.ReplaceAll(upper, " ", "_")
+	return upper
+}
+
+func (s designStatus) editable() bool {
+	return s == statusDraft || s == statusRejected
+}
 
-	const bearerPrefix = "Bearer "
-	if !strings.HasPrefix(authHeader, bearerPrefix) {
-		return userRecord{}, errors.New("invalid authorization header")
+func normalizeMaterialName(value string) string {
+	lower := strings.ToLower(strings.TrimSpace(value))
+	lower = strings.ReplaceAll(lower, "-", "_")
+	lower = strings.ReplaceAll(lower, " ", "_")
+	for strings.Contains(lower, "__") {
+		lower = strings.ReplaceAll(lower, "__", "_")
 	}
-	tokenString := strings.TrimSpace(strings.TrimPrefix(authHeader, bearerPrefix))
-	if tokenString == "" {
-		return userRecord{}, errors.New("invalid authorization header")
+	return lower
+}
+
+func computeETag(payload interface{}) (string, error) {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
 	}
+	sum := sha256.Sum256(encoded)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
 
-	token, err := jwt.ParseWithClaims(tokenString, &authClaims{}, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
 		}
-		return a.jwtSecret, nil
-	})
-	if err != nil {
-		return userRecord{}, err
 	}
+	return false
+}
 
-	claims, ok := token.Claims.(*authClaims)
-	if !ok || !token.Valid {
-		return userRecord{}, errors.New("invalid token")
+func (a *app) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !a.isTrustedProxy(host) {
+		return host
 	}
 
-	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
-	if err != nil || userID <= 0 {
-		return userRecord{}, errors.New("invalid token subject")
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !a.isTrustedProxy(hop) {
+			return hop
+		}
+		host = hop
 	}
+	return host
+}
 
-	user, err := a.findUserByID(r.Context(), userID)
+func (a *app) isTrustedProxy(value string) bool {
+	addr, err := netip.ParseAddr(value)
 	if err != nil {
-		return userRecord{}, err
+		return false
 	}
-	return user, nil
+	addr = addr.Unmap()
+	for _, prefix := range a.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
 }
 
-func (a *app) signToken(user userRecord) (string, error) {
-	now := time.Now().UTC()
-	claims := authClaims{
-		Email: user.Email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(now.Add(tokenTTL)),
-			IssuedAt:  jwt.NewNumericDate(now),
-			Subject:   strconv.FormatInt(user.ID, 10),
-		},
+func decodeJSON(r *http.Request, target interface{}) error {
+	return decodeJSONReader(r.Body, target)
+}
+
+func decodeJSONReader(body io.Reader, target interface{}) error {
+	decoder := json.NewDecoder(body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(target); err != nil {
+		return err
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(a.jwtSecret)
+	if err := decoder.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		return errTrailingJSON
+	}
+	return nil
 }
 
-func (a *app) findUserByEmail(ctx context.Context, email string) (userRecord, error) {
-	var user userRecord
-	err := a.db.QueryRowContext(
-		ctx,
-		`SELECT id, email, password_hash FROM users WHERE email = ?`,
-		email,
-	).Scan(&user.ID, &user.Email, &user.PasswordHash)
-	if err != nil {
-		return userRecord{}, err
+func writeJSON(w http.ResponseWriter, status int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	payload := map[string]string{"code": code, "error": message}
+	if requestID := w.Header().Get("X-Request-ID"); requestID != "" {
+		payload["requestId"] = requestID
 	}
-	return user, nil
+	writeJSON(w, status, payload)
 }
 
-func (a *app) findUserByID(ctx context.Context, userID int64) (userRecord, error) {
-	var user userRecord
-	err := a.db.QueryRowContext(
-		ctx,
-		`SELECT id, email, password_hash FROM users WHERE id = ?`,
-		userID,
-	).Scan(&user.ID, &user.Email, &user.PasswordHash)
-	if err != nil {
-		return userRecord{}, err
+func (e *codedError) Error() string {
+	return e.message
+}
+
+func errorCode(err error, fallback string) string {
+	var coded *codedError
+	if errors.As(err, &coded) {
+		return coded.code
 	}
-	return user, nil
+	return fallback
 }
 
-func validateSelections(
-	selections map[string]materialSelection,
-) (map[string]materialSelection, error) {
-	if len(selections) == 0 {
-		return nil, errors.New("selections must include at least one material")
+func writeDecodeError(w http.ResponseWriter, err error) {
+	payload := map[string]string{"code": codeInvalidJSON, "error": "invalid JSON payload"}
+	if requestID := w.Header().Get("X-Request-ID"); requestID != "" {
+		payload["requestId"] = requestID
 	}
 
-	allowedMaterialKeys := map[string]bool{}
-	for _, item := range defaultCatalog.Materials {
-		allowedMaterialKeys[item.Key] = true
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &syntaxErr):
+		payload["detail"] = fmt.Sprintf("malformed JSON at offset %d", syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		payload["field"] = typeErr.Field
+		payload["expected"] = typeErr.Type.String()
+		payload["detail"] = fmt.Sprintf("field %q must be %s, got %s", typeErr.Field, typeErr.Type, typeErr.Value)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		payload["field"] = field
+		payload["detail"] = fmt.Sprintf("unknown field %q", field)
+	case errors.Is(err, errTrailingJSON):
+		payload["detail"] = "request body must contain a single JSON value"
+	case errors.Is(err, io.EOF):
+		payload["detail"] = "request body is empty"
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		payload["detail"] = "request body is truncated"
 	}
 
-	allowedFinishes := map[string]bool{}
-	for _, finish := range defaultCatalog.AllowedFinishes {
-		allowedFinishes[finish] = true
+	writeJSON(w, http.StatusBadRequest, payload)
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
 	}
+	s.ResponseWriter.WriteHeader(status)
+}
 
-	allowedPatterns := map[string]bool{}
-	for _, pattern := range defaultCatalog.AllowedPatternIDs {
-		allowedPatterns[pattern] = true
+func (s *statusRecorder) Write(data []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
 	}
+	return s.ResponseWriter.Write(data)
+}
 
-	validated := make(map[string]materialSelection, len(selections))
-	for key, value := range selections {
-		if !allowedMaterialKeys[key] {
-			return nil, fmt.Errorf("material key %q is not allowed", key)
-		}
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
 
-		color := strings.ToUpper(strings.TrimSpace(value.ColorHex))
-		if !hexRegex.MatchString(color) {
-			return nil, fmt.Errorf("material %q has invalid colorHex", key)
-		}
-		if !allowedFinishes[value.Finish] {
-			return nil, fmt.Errorf("material %q has invalid finish", key)
-		}
-		if !allowedPatterns[value.PatternID] {
-			return nil, fmt.Errorf("material %q has invalid patternId", key)
-		}
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
 
-		validated[key] = materialSelection{
-			ColorHex:  color,
-			Finish:    value.Finish,
-			PatternID: value.PatternID,
-		}
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	buffer      bytes.Buffer
+	gzip        *gzip.Writer
+	passthrough bool
+	status      int
+}
+
+func (g *gzipResponseWriter) WriteHeader(status int) {
+	if g.status != 0 {
+		return
 	}
+	g.status = status
 
-	return validated, nil
+	contentType := g.Header().Get("Content-Type")
+	if !strings.HasPrefix(contentType, "application/json") || g.Header().Get("Content-Encoding") != "" ||
+		status == http.StatusNoContent || status == http.StatusNotModified {
+		g.passthrough = true
+		g.ResponseWriter.WriteHeader(status)
+	}
 }
 
-func validateSubmissionSelections(selections map[string]materialSelection) error {
-	hasBodyPaint := false
-	hasGlass := false
+func (g *gzipResponseWriter) Write(data []byte) (int, error) {
+	if g.status == 0 {
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.passthrough {
+		return g.ResponseWriter.Write(data)
+	}
+	if g.gzip != nil {
+		return g.gzip.Write(data)
+	}
 
-	for key, value := range selections {
-		normalizedKey := normalizeMaterialName(key)
-		switch normalizedKey {
-		case "material_9", "bodypaint", "body_paint":
-			hasBodyPaint = true
-		case "material_3", "glass", "glassset", "glass_set":
-			hasGlass = true
-			if strings.ToUpper(strings.TrimSpace(value.PatternID)) != "NONE" {
-				return errors.New("Glass selection must use patternId NONE before submission")
-			}
+	g.buffer.Write(data)
+	if g.buffer.Len() >= gzipMinSize {
+		if err := g.startGzip(); err != nil {
+			return 0, err
 		}
 	}
+	return len(data), nil
+}
 
-	if !hasBodyPaint {
-		return errors.New("submission requires a Body_Paint selection")
+func (g *gzipResponseWriter) startGzip() error {
+	g.Header().Set("Content-Encoding", "gzip")
+	g.Header().Del("Content-Length")
+	g.ResponseWriter.WriteHeader(g.status)
+	g.gzip = gzip.NewWriter(g.ResponseWriter)
+	_, err := g.gzip.Write(g.buffer.Bytes())
+	g.buffer.Reset()
+	return err
+}
+
+func (g *gzipResponseWriter) Flush() {
+	if g.gzip != nil {
+		_ = g.gzip.Flush()
 	}
-	if !hasGlass {
-		return errors.New("submission requires a Glass selection")
+	if flusher, ok := g.ResponseWriter.(http.Flusher); ok && (g.passthrough || g.gzip != nil) {
+		flusher.Flush()
 	}
-	return nil
 }
 
-func normalizeMaterialName(value string) string {
-	lower := strings.ToLower(strings.TrimSpace(value))
-	lower = strings.ReplaceAll(lower, "-", "_")
-	lower = strings.ReplaceAll(lower, " ", "_")
-	for strings.Contains(lower, "__") {
-		lower = strings.ReplaceAll(lower, "__", "_")
+func (g *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
+func (g *gzipResponseWriter) close() {
+	switch {
+	case g.status == 0 || g.passthrough:
+	case g.gzip != nil:
+		_ = g.gzip.Close()
+	default:
+		g.ResponseWriter.WriteHeader(g.status)
+		_, _ = g.ResponseWriter.Write(g.buffer.Bytes())
 	}
-	return lower
 }
 
-func decodeJSON(r *http.Request, target interface{}) error {
-	decoder := json.NewDecoder(r.Body)
-	decoder.DisallowUnknownFields()
-	return decoder.Decode(target)
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		encoding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(encoding), "gzip") {
+			continue
+		}
+		quality := strings.ReplaceAll(strings.TrimSpace(params), " ", "")
+		return quality != "q=0" && quality != "q=0.0" && quality != "q=0.00" && quality != "q=0.000"
+	}
+	return false
 }
 
-func writeJSON(w http.ResponseWriter, status int, payload interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	_ = json.NewEncoder(w).Encode(payload)
+func newRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(buf)
+}
+
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := strings.TrimSpace(r.Header.Get("X-Request-ID"))
+		if !requestIDRegex.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+
+		w.Header().Set("X-Request-ID", requestID)
+		recorder := &statusRecorder{ResponseWriter: w}
+		started := time.Now()
+
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), requestIDKey, requestID)))
+
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		log.Printf(
+			"request_id=%s method=%s path=%s status=%d duration=%s",
+			requestID,
+			r.Method,
+			r.URL.Path,
+			recorder.status,
+			time.Since(started).Round(time.Microsecond),
+		)
+	})
+}
+
+func withGzip(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		writer := &gzipResponseWriter{ResponseWriter: w}
+		defer writer.close()
+		next.ServeHTTP(writer, r)
+	})
 }
 
-func writeError(w http.ResponseWriter, status int, message string) {
-	writeJSON(w, status, map[string]string{"error": message})
+func withHandlerName(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern != "" {
+			r = r.WithContext(context.WithValue(r.Context(), handlerKey, pattern))
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
-func withCORS(next http.Handler) http.Handler {
+func withCORS(mux *http.ServeMux, cors corsConfig, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Admin-Secret")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, OPTIONS")
+		if len(cors.allowedOrigins) == 0 {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Add("Vary", "Origin")
+			if origin := r.Header.Get("Origin"); cors.allowedOrigins[origin] {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				if cors.allowCredentials {
+					w.Header().Set("Access-Control-Allow-Credentials", "true")
+				}
+			}
+		}
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Admin-Secret, If-None-Match, X-Request-ID, Idempotency-Key, X-Auth-Mode")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, X-Request-ID, Idempotent-Replayed, X-Duplicate-Of, X-Total-Count, Link, Retry-After")
 		if r.Method == http.MethodOptions {
+			methods := allowedMethods(mux, r)
+			if len(methods) == 0 {
+				writeError(w, http.StatusNotFound, codeNotFound, "not found")
+				return
+			}
+			allowed := strings.Join(append(methods, http.MethodOptions), ", ")
+			w.Header().Set("Access-Control-Allow-Methods", allowed)
+			w.Header().Set("Allow", allowed)
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 		next.ServeHTTP(w, r)
 	})
 }
+
+func allowedMethods(mux *http.ServeMux, r *http.Request) []string {
+	methods := make([]string, 0, 6)
+	for _, method := range []string{
+		http.MethodGet,
+		http.MethodHead,
+		http.MethodPost,
+		http.MethodPut,
+		http.MethodPatch,
+		http.MethodDelete,
+	} {
+		probe := r.Clone(r.Context())
+		probe.Method = method
+		if _, pattern := mux.Handler(probe); pattern != "" {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
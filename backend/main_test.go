@@ -0,0 +1,816 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testSelections = map[string]materialSelection{
+	"material_1": {ColorHex: "#191C22", Finish: "MATTE", PatternID: "NONE"},
+	"material_3": {ColorHex: "#000000", Finish: "GLOSS", PatternID: "NONE"},
+	"material_5": {ColorHex: "#1C212A", Finish: "MATTE", PatternID: "NONE"},
+	"material_6": {ColorHex: "#242D38", Finish: "MATTE", PatternID: "NONE"},
+	"material_7": {ColorHex: "#2E343E", Finish: "MATTE", PatternID: "NONE"},
+	"material_8": {ColorHex: "#0C0D10", Finish: "MATTE", PatternID: "NONE"},
+	"material_9": {ColorHex: "#0B0B0C", Finish: "MATTE", PatternID: "NONE"},
+}
+
+func newTestApp(t *testing.T, busyTimeoutMS int) (*app, string) {
+	t.Helper()
+
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	dsn := sqliteDSN(dbPath)
+	if busyTimeoutMS > 0 {
+		dsn = strings.Replace(dsn, "_busy_timeout=5000", fmt.Sprintf("_busy_timeout=%d", busyTimeoutMS), 1)
+	}
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := initSchema(db); err != nil {
+		t.Fatalf("init schema: %v", err)
+	}
+
+	return &app{
+		bcryptCost:    bcrypt.MinCost,
+		db:            &timedDB{DB: db},
+		designEvents:  newDesignEventHub(),
+		jwtSecret:     []byte("test-secret"),
+		maxNameLength: 120,
+	}, dbPath
+}
+
+func createTestUser(t *testing.T, a *app, email string) string {
+	t.Helper()
+
+	result, err := a.db.Exec(
+		`INSERT INTO users(email, normalized_email, password_hash, created_at) VALUES (?, ?, ?, ?)`,
+		email,
+		email,
+		"unused",
+		time.Now().UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		t.Fatalf("user id: %v", err)
+	}
+
+	token, err := a.signToken(userRecord{Email: email, ID: id})
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return token
+}
+
+func doJSON(t *testing.T, method, url, token string, body interface{}) (int, []byte) {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			t.Errorf("encode body: %v", err)
+			return 0, nil
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		t.Errorf("new request: %v", err)
+		return 0, nil
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Errorf("%s %s: %v", method, url, err)
+		return 0, nil
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Errorf("read body: %v", err)
+	}
+	return resp.StatusCode, respBody
+}
+
+func TestConcurrentCreatesDoNotSurfaceLockErrors(t *testing.T) {
+	a, _ := newTestApp(t, 0)
+	a.db.SetMaxOpenConns(10)
+	token := createTestUser(t, a, "concurrent@example.com")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /designs", a.requireAuth(a.handleCreateDesign))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	const creates = 40
+	var wg sync.WaitGroup
+	statuses := make([]int, creates)
+	bodies := make([][]byte, creates)
+	for i := 0; i < creates; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			statuses[i], bodies[i] = doJSON(t, http.MethodPost, server.URL+"/designs", token, map[string]interface{}{
+				"name":       fmt.Sprintf("Design %d", i),
+				"selections": testSelections,
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	for i, status := range statuses {
+		if status != http.StatusCreated {
+			t.Errorf("create %d: status %d, body %s", i, status, bodies[i])
+		}
+		if strings.Contains(strings.ToLower(string(bodies[i])), "locked") {
+			t.Errorf("create %d leaked a lock error: %s", i, bodies[i])
+		}
+	}
+
+	var count int
+	if err := a.db.QueryRow(`SELECT COUNT(*) FROM designs`).Scan(&count); err != nil {
+		t.Fatalf("count designs: %v", err)
+	}
+	if count != creates {
+		t.Fatalf("designs = %d, want %d", count, creates)
+	}
+}
+
+func TestConcurrentSubmitsAllowExactlyOne(t *testing.T) {
+	a, _ := newTestApp(t, 0)
+	a.db.SetMaxOpenConns(10)
+	token := createTestUser(t, a, "submit@example.com")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /designs", a.requireAuth(a.handleCreateDesign))
+	mux.HandleFunc("POST /designs/{id}/submit", a.requireAuth(a.handleSubmitDesign))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	status, body := doJSON(t, http.MethodPost, server.URL+"/designs", token, map[string]interface{}{
+		"name":       "Submit race",
+		"selections": testSelections,
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("create: status %d, body %s", status, body)
+	}
+	var created designRecord
+	if err := json.Unmarshal(body, &created); err != nil {
+		t.Fatalf("decode design: %v", err)
+	}
+
+	const submits = 20
+	var wg sync.WaitGroup
+	statuses := make([]int, submits)
+	for i := 0; i < submits; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			statuses[i], _ = doJSON(t, http.MethodPost, server.URL+"/designs/"+created.ID+"/submit", token, nil)
+		}(i)
+	}
+	wg.Wait()
+
+	counts := map[int]int{}
+	for _, status := range statuses {
+		counts[status]++
+	}
+	if counts[http.StatusOK] != 1 || counts[http.StatusConflict] != submits-1 {
+		t.Fatalf("statuses = %v, want one 200 and %d 409s", counts, submits-1)
+	}
+}
+
+func TestCreateReturns503WhileDatabaseLockedThenRecovers(t *testing.T) {
+	a, dbPath := newTestApp(t, 50)
+	token := createTestUser(t, a, "busy@example.com")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /designs", a.requireAuth(a.handleCreateDesign))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	lockDB, err := sql.Open("sqlite3", sqliteDSN(dbPath))
+	if err != nil {
+		t.Fatalf("open lock db: %v", err)
+	}
+	defer lockDB.Close()
+
+	lockTx, err := lockDB.Begin()
+	if err != nil {
+		t.Fatalf("begin lock tx: %v", err)
+	}
+	if _, err := lockTx.Exec(`UPDATE users SET email = email`); err != nil {
+		t.Fatalf("take write lock: %v", err)
+	}
+
+	payload := map[string]interface{}{"name": "Busy", "selections": testSelections}
+	status, body := doJSON(t, http.MethodPost, server.URL+"/designs", token, payload)
+	if status != http.StatusServiceUnavailable {
+		t.Fatalf("while locked: status %d, body %s", status, body)
+	}
+	var errorBody map[string]string
+	if err := json.Unmarshal(body, &errorBody); err != nil || errorBody["code"] != codeDatabaseBusy {
+		t.Fatalf("while locked: body %s, want code %s", body, codeDatabaseBusy)
+	}
+
+	if err := lockTx.Rollback(); err != nil {
+		t.Fatalf("release lock: %v", err)
+	}
+
+	status, body = doJSON(t, http.MethodPost, server.URL+"/designs", token, payload)
+	if status != http.StatusCreated {
+		t.Fatalf("after unlock: status %d, body %s", status, body)
+	}
+}
+
+func TestIsBusyError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("database is locked"), true},
+		{errors.New("database is locked (5) (SQLITE_BUSY)"), true},
+		{errors.New("Database Table Is Locked"), true},
+		{fmt.Errorf("insert design: %w", errors.New("database is locked")), true},
+		{errors.New("UNIQUE constraint failed: users.email"), false},
+		{sql.ErrNoRows, false},
+	}
+
+	for _, test := range tests {
+		if got := isBusyError(test.err); got != test.want {
+			t.Errorf("isBusyError(%q) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
+func TestAdminSubmissionsQueryUsesStatusUpdatedIndex(t *testing.T) {
+	a, _ := newTestApp(t, 0)
+
+	rows, err := a.db.Query(
+		`EXPLAIN QUERY PLAN `+adminSubmissionsQuery("d.status = ?"),
+		string(statusSubmitted),
+		20,
+		0,
+	)
+	if err != nil {
+		t.Fatalf("explain: %v", err)
+	}
+	defer rows.Close()
+
+	details := make([]string, 0)
+	for rows.Next() {
+		var (
+			id, parent, unused int
+			detail             string
+		)
+		if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+			t.Fatalf("scan plan: %v", err)
+		}
+		details = append(details, detail)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("read plan: %v", err)
+	}
+
+	plan := strings.Join(details, "\n")
+	if !strings.Contains(plan, "idx_designs_status_updated") {
+		t.Errorf("plan does not use idx_designs_status_updated:\n%s", plan)
+	}
+	if strings.Contains(plan, "USE TEMP B-TREE") {
+		t.Errorf("plan sorts with a temp b-tree:\n%s", plan)
+	}
+}
+
+func TestRevokedTokensRejectOnlyEarlierIssues(t *testing.T) {
+	a, _ := newTestApp(t, 0)
+	createTestUser(t, a, "revoke@example.com")
+
+	now := time.Now().UTC()
+	if _, err := a.db.Exec(`UPDATE users SET tokens_invalid_before = ? WHERE id = 1`, now.Format(time.RFC3339Nano)); err != nil {
+		t.Fatalf("revoke tokens: %v", err)
+	}
+
+	sign := func(issuedAt time.Time) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, authClaims{
+			Email: "revoke@example.com",
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(issuedAt.Add(tokenTTL)),
+				IssuedAt:  jwt.NewNumericDate(issuedAt),
+				Subject:   "1",
+			},
+		}).SignedString(a.jwtSecret)
+		if err != nil {
+			t.Fatalf("sign token: %v", err)
+		}
+		return token
+	}
+
+	for _, test := range []struct {
+		name     string
+		issuedAt time.Time
+		wantErr  bool
+	}{
+		{"whole second of the revoke", now.Truncate(time.Second), true},
+		{"same instant as revoke", now, true},
+		{"milliseconds after revoke", now.Add(5 * time.Millisecond), false},
+		{"before revoke", now.Add(-time.Second), true},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+sign(test.issuedAt))
+		_, err := a.userFromRequest(req)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestClientIPHonoursForwardedForOnlyFromTrustedProxies(t *testing.T) {
+	a := &app{trustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{"untrusted peer spoofing header", "203.0.113.9:5000", "198.51.100.1", "203.0.113.9"},
+		{"trusted proxy", "10.0.0.2:5000", "198.51.100.1", "198.51.100.1"},
+		{"client-supplied hop before proxy", "10.0.0.2:5000", "1.2.3.4, 198.51.100.1", "198.51.100.1"},
+		{"chain of trusted proxies", "10.0.0.2:5000", "198.51.100.1, 10.1.1.1", "198.51.100.1"},
+		{"trusted proxy without header", "10.0.0.2:5000", "", "10.0.0.2"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/auth/register", nil)
+		req.RemoteAddr = test.remoteAddr
+		if test.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+		if got := a.clientIP(req); got != test.want {
+			t.Errorf("%s: clientIP = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestNegotiateExportFormatHonoursQualityValues(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+		ok     bool
+	}{
+		{"", "json", true},
+		{"application/pdf", "pdf", true},
+		{"application/pdf;q=0, application/json", "json", true},
+		{"text/csv;q=0.5, application/pdf", "pdf", true},
+		{"text/csv, application/json;q=0.9", "csv", true},
+		{"application/pdf;q=0", "", false},
+		{"image/png", "", false},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/designs/1/export", nil)
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		got, ok := negotiateExportFormat(req)
+		if got != test.want || ok != test.ok {
+			t.Errorf("Accept %q: got (%q, %v), want (%q, %v)", test.accept, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestUniqueDesignNamesEnforcedUnderConcurrency(t *testing.T) {
+	a, _ := newTestApp(t, 0)
+	a.db.SetMaxOpenConns(10)
+	a.uniqueNames = true
+	if err := syncDesignNameIndex(a.db.DB, true); err != nil {
+		t.Fatalf("sync name index: %v", err)
+	}
+	token := createTestUser(t, a, "unique@example.com")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /designs", a.requireAuth(a.handleCreateDesign))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	const creates = 20
+	var wg sync.WaitGroup
+	statuses := make([]int, creates)
+	for i := 0; i < creates; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			statuses[i], _ = doJSON(t, http.MethodPost, server.URL+"/designs", token, map[string]interface{}{
+				"name":       fmt.Sprintf("  Same Name%s ", strings.Repeat(" ", i%2)),
+				"selections": testSelections,
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	counts := map[int]int{}
+	for _, status := range statuses {
+		counts[status]++
+	}
+	if counts[http.StatusCreated] != 1 || counts[http.StatusConflict] != creates-1 {
+		t.Fatalf("statuses = %v, want one 201 and %d 409", counts, creates-1)
+	}
+
+	// The index, not the handler's pre-check, is what stops an insert that raced past it.
+	if _, err := insertDesign(context.Background(), a.db, 1, "SAME NAME", testSelections, 0); !errors.Is(err, errDuplicateName) {
+		t.Fatalf("direct insert: err = %v, want errDuplicateName", err)
+	}
+}
+
+func TestNameKeyMigrationBackfillsAndIndexRejectsExistingDuplicates(t *testing.T) {
+	a, _ := newTestApp(t, 0)
+	createTestUser(t, a, "backfill@example.com")
+
+	if _, err := a.db.Exec(`ALTER TABLE designs DROP COLUMN name_key`); err != nil {
+		t.Fatalf("simulate pre-migration schema: %v", err)
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, name := range []string{"Road Trip", " road trip"} {
+		if _, err := a.db.Exec(
+			`INSERT INTO designs(user_id, name, selections_json, created_at, updated_at) VALUES (1, ?, '{}', ?, ?)`,
+			name,
+			now,
+			now,
+		); err != nil {
+			t.Fatalf("insert design: %v", err)
+		}
+	}
+
+	if err := initSchema(a.db.DB); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	var missing int
+	if err := a.db.QueryRow(`SELECT COUNT(*) FROM designs WHERE name_key IS NULL OR name_key != 'road trip'`).Scan(&missing); err != nil {
+		t.Fatalf("count keys: %v", err)
+	}
+	if missing != 0 {
+		t.Fatalf("%d designs were not backfilled", missing)
+	}
+
+	if err := syncDesignNameIndex(a.db.DB, true); err == nil || !strings.Contains(err.Error(), "road trip") {
+		t.Fatalf("enable unique names with duplicates: err = %v, want a conflict naming the design", err)
+	}
+
+	if _, err := a.db.Exec(`UPDATE designs SET name = 'Road Trip 2', name_key = 'road trip 2' WHERE id = 2`); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	if err := syncDesignNameIndex(a.db.DB, true); err != nil {
+		t.Fatalf("sync after rename: %v", err)
+	}
+}
+
+func TestAdminSubmissionsPaginateOnlyWhenAsked(t *testing.T) {
+	a, _ := newTestApp(t, 0)
+	createTestUser(t, a, "pages@example.com")
+
+	const submitted = defaultPageLimit + 5
+	now := time.Now().UTC().Format(time.RFC3339)
+	for i := 0; i < submitted; i++ {
+		if _, err := a.db.Exec(
+			`INSERT INTO designs(user_id, name, selections_json, status, created_at, updated_at) VALUES (1, ?, '{}', 'SUBMITTED', ?, ?)`,
+			fmt.Sprintf("Design %d", i),
+			now,
+			now,
+		); err != nil {
+			t.Fatalf("insert design: %v", err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/submissions", a.handleAdminListSubmissions)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for _, tc := range []struct {
+		query string
+		want  int
+	}{
+		{"", submitted},
+		{"?limit=10", 10},
+		{"?offset=50", submitted - 50},
+	} {
+		status, body := doJSON(t, http.MethodGet, server.URL+"/admin/submissions"+tc.query, "", nil)
+		if status != http.StatusOK {
+			t.Fatalf("%q: status %d, body %s", tc.query, status, body)
+		}
+		var response adminSubmissionsResponse
+		if err := json.Unmarshal(body, &response); err != nil {
+			t.Fatalf("%q: decode: %v", tc.query, err)
+		}
+		if len(response.Designs) != tc.want || response.Total != submitted {
+			t.Fatalf("%q: got %d designs (total %d), want %d (total %d)", tc.query, len(response.Designs), response.Total, tc.want, submitted)
+		}
+	}
+}
+
+func TestSlowQueryLogNamesRouteForTransactionQueries(t *testing.T) {
+	a, _ := newTestApp(t, 0)
+	a.db.slowQueryThreshold = time.Nanosecond
+	token := createTestUser(t, a, "slow@example.com")
+
+	var logs bytes.Buffer
+	previous := log.Writer()
+	log.SetOutput(&logs)
+	defer log.SetOutput(previous)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /designs", a.requireAuth(a.handleCreateDesign))
+	server := httptest.NewServer(withRequestID(withHandlerName(mux, mux)))
+	defer server.Close()
+
+	status, body := doJSON(t, http.MethodPost, server.URL+"/designs", token, map[string]interface{}{
+		"name":       "Slow",
+		"selections": designTemplates[0].Selections,
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("create: status %d, body %s", status, body)
+	}
+
+	sawInsert := false
+	for _, line := range strings.Split(logs.String(), "\n") {
+		start := strings.Index(line, "{")
+		if start < 0 {
+			continue
+		}
+		var entry slowQueryLog
+		if err := json.Unmarshal([]byte(line[start:]), &entry); err != nil || entry.Message != "slow query" {
+			continue
+		}
+		if entry.Handler != "POST /designs" {
+			t.Errorf("handler = %q for %q, want %q", entry.Handler, entry.Query, "POST /designs")
+		}
+		if strings.HasPrefix(entry.Query, "INSERT INTO designs") {
+			sawInsert = true
+		}
+	}
+	if !sawInsert {
+		t.Fatalf("no slow query entry for the transactional insert; logs:\n%s", logs.String())
+	}
+}
+
+func TestSubmissionRejectsCatalogDefaultColors(t *testing.T) {
+	if problems := submissionProblems(testSelections); len(problems) != 0 {
+		t.Fatalf("chosen colors: unexpected problems %v", problems)
+	}
+
+	for _, key := range []string{"material_3", "material_9"} {
+		material, ok := findCatalogMaterial(key)
+		if !ok {
+			t.Fatalf("catalog has no %s", key)
+		}
+
+		selections := map[string]materialSelection{}
+		for k, v := range testSelections {
+			selections[k] = v
+		}
+		selection := selections[key]
+		selection.ColorHex = strings.ToLower(material.defaultColor())
+		selections[key] = selection
+
+		if problems := submissionProblems(selections); len(problems) != 1 {
+			t.Errorf("%s at its catalog default: problems %v, want exactly one", key, problems)
+		}
+	}
+}
+
+func TestCapPprofSecondsStaysBelowWriteTimeout(t *testing.T) {
+	var got string
+	handler := capPprofSeconds(30*time.Second, 30, func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.Query().Get("seconds")
+	})
+
+	for query, want := range map[string]string{
+		"":             "25",
+		"?seconds=60":  "25",
+		"?seconds=10":  "10",
+		"?seconds=abc": "25",
+	} {
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/debug/pprof/profile"+query, nil))
+		if got != want {
+			t.Errorf("%q: seconds = %q, want %q", query, got, want)
+		}
+	}
+}
+
+func TestListDesignsCursorLinksWalkBothWays(t *testing.T) {
+	a, _ := newTestApp(t, 0)
+	token := createTestUser(t, a, "cursor@example.com")
+
+	createdAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		stamp := createdAt.Add(time.Duration(i) * time.Minute).Format(time.RFC3339)
+		if _, err := a.db.Exec(
+			`INSERT INTO designs(user_id, name, selections_json, created_at, updated_at) VALUES (1, ?, '{}', ?, ?)`,
+			fmt.Sprintf("Design %d", i),
+			stamp,
+			stamp,
+		); err != nil {
+			t.Fatalf("insert design: %v", err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /designs", a.requireAuth(a.handleListDesigns))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	page := func(query string) (listDesignsResponse, string) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/designs"+query, nil)
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("list %q: %v", query, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			t.Fatalf("list %q: status %d, body %s", query, resp.StatusCode, body)
+		}
+		var response listDesignsResponse
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			t.Fatalf("decode %q: %v", query, err)
+		}
+		return response, resp.Header.Get("Link")
+	}
+	ids := func(response listDesignsResponse) string {
+		values := make([]string, 0, len(response.Designs))
+		for _, design := range response.Designs {
+			values = append(values, design.ID)
+		}
+		return strings.Join(values, ",")
+	}
+
+	first, link := page("?limit=2")
+	if ids(first) != "5,4" || first.PrevCursor != nil || first.NextCursor == nil || strings.Contains(link, `rel="prev"`) {
+		t.Fatalf("first page: ids %s, link %q", ids(first), link)
+	}
+
+	second, link := page("?limit=2&after=" + *first.NextCursor)
+	if ids(second) != "3,2" || second.PrevCursor == nil || second.NextCursor == nil ||
+		!strings.Contains(link, `rel="next"`) || !strings.Contains(link, `rel="prev"`) {
+		t.Fatalf("second page: ids %s, link %q", ids(second), link)
+	}
+
+	back, link := page("?limit=2&before=" + *second.PrevCursor)
+	if ids(back) != "5,4" || back.PrevCursor != nil || back.NextCursor == nil || strings.Contains(link, `rel="prev"`) {
+		t.Fatalf("back to first page: ids %s, link %q", ids(back), link)
+	}
+
+	status, body := doJSON(t, http.MethodGet, server.URL+"/designs?offset=2", token, nil)
+	if status != http.StatusBadRequest {
+		t.Fatalf("offset: status %d, body %s, want 400", status, body)
+	}
+}
+
+func TestInsertDesignEnforcesLimitInTheInsert(t *testing.T) {
+	a, _ := newTestApp(t, 0)
+	createTestUser(t, a, "limit@example.com")
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := insertDesign(ctx, a.db, 1, fmt.Sprintf("Limited %d", i), testSelections, 3); err != nil {
+			t.Fatalf("insert %d under the limit: %v", i, err)
+		}
+	}
+
+	if _, err := insertDesign(ctx, a.db, 1, "Over", testSelections, 3); !errors.Is(err, errDesignLimit) {
+		t.Fatalf("insert at the limit: err = %v, want errDesignLimit", err)
+	}
+	if _, err := insertDesign(ctx, a.db, 1, "Unlimited", testSelections, 0); err != nil {
+		t.Fatalf("insert without a limit: %v", err)
+	}
+
+	var count int
+	if err := a.db.QueryRow(`SELECT COUNT(*) FROM designs WHERE user_id = 1`).Scan(&count); err != nil {
+		t.Fatalf("count designs: %v", err)
+	}
+	if count != 4 {
+		t.Fatalf("designs = %d, want 4", count)
+	}
+}
+
+func TestAutosaveRejectsStaleOrMissingVersion(t *testing.T) {
+	a, _ := newTestApp(t, 0)
+	token := createTestUser(t, a, "autosave@example.com")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /designs", a.requireAuth(a.handleCreateDesign))
+	mux.HandleFunc("PUT /designs/{id}", a.requireAuth(a.handleUpdateDesign))
+	mux.HandleFunc("PATCH /designs/{id}/autosave", a.requireAuth(a.handleAutosaveDesign))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	status, body := doJSON(t, http.MethodPost, server.URL+"/designs", token, map[string]interface{}{
+		"name":       "Autosave",
+		"selections": testSelections,
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("create: status %d, body %s", status, body)
+	}
+	var created designRecord
+	if err := json.Unmarshal(body, &created); err != nil {
+		t.Fatalf("decode design: %v", err)
+	}
+	designURL := server.URL + "/designs/" + created.ID
+
+	status, body = doJSON(t, http.MethodPut, designURL, token, map[string]interface{}{
+		"name":       "Saved from another tab",
+		"selections": testSelections,
+		"version":    created.Version,
+	})
+	if status != http.StatusOK {
+		t.Fatalf("put: status %d, body %s", status, body)
+	}
+
+	for _, test := range []struct {
+		name string
+		body map[string]interface{}
+		want int
+	}{
+		{"missing version", map[string]interface{}{"name": "Stale", "selections": testSelections}, http.StatusBadRequest},
+		{"stale version", map[string]interface{}{"name": "Stale", "selections": testSelections, "version": created.Version}, http.StatusConflict},
+	} {
+		status, body := doJSON(t, http.MethodPatch, designURL+"/autosave", token, test.body)
+		if status != test.want {
+			t.Errorf("%s: status %d, body %s, want %d", test.name, status, body, test.want)
+		}
+	}
+}
+
+func TestSetDesignStatusOnlyMovesSubmittedDesigns(t *testing.T) {
+	a, _ := newTestApp(t, 0)
+	createTestUser(t, a, "review@example.com")
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := a.db.Exec(
+		`INSERT INTO designs(user_id, name, selections_json, status, submitted_at, created_at, updated_at) VALUES (1, 'Review', '{}', 'SUBMITTED', ?, ?, ?)`,
+		now,
+		now,
+		now,
+	); err != nil {
+		t.Fatalf("insert design: %v", err)
+	}
+
+	ctx := context.Background()
+	if _, err := a.setDesignStatus(ctx, 1, statusApproved, nil); err != nil {
+		t.Fatalf("approve: %v", err)
+	}
+
+	// A reject that passed its status check before the approve committed must not apply.
+	reason := "too late"
+	if _, err := a.setDesignStatus(ctx, 1, statusRejected, &reason); !errors.Is(err, errStatusChanged) {
+		t.Fatalf("reject after approve: err = %v, want errStatusChanged", err)
+	}
+
+	var (
+		status string
+		audits int
+	)
+	if err := a.db.QueryRow(`SELECT status FROM designs WHERE id = 1`).Scan(&status); err != nil {
+		t.Fatalf("load status: %v", err)
+	}
+	if err := a.db.QueryRow(`SELECT COUNT(*) FROM admin_audit_log WHERE design_id = 1`).Scan(&audits); err != nil {
+		t.Fatalf("count audit rows: %v", err)
+	}
+	if status != string(statusApproved) || audits != 1 {
+		t.Fatalf("status = %s with %d audit rows, want APPROVED with 1", status, audits)
+	}
+}
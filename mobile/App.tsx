@@ -210,6 +210,7 @@ export default function App() {
             designToSubmit = await updateDesign(authToken, design.id, {
               materials: patchedMaterials,
               name: design.name,
+              version: design.version,
             });
           }
         }
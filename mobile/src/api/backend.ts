@@ -9,6 +9,7 @@ import type {
   LoginResponse,
   RegisterRequest,
   RegisterResponse,
+  UpdateDesignRequest,
   UserProfile,
 } from '../types/api';
 import { toSavedDesign } from '../types/api';
@@ -16,6 +17,7 @@ import { toSavedDesign } from '../types/api';
 type RequestMethod = 'GET' | 'POST' | 'PUT';
 
 type ApiErrorPayload = {
+  code?: string;
   error?: string;
 };
 
@@ -25,10 +27,12 @@ const DEFAULT_BASE_URL =
 const API_BASE_URL = (process.env.EXPO_PUBLIC_API_BASE_URL ?? DEFAULT_BASE_URL).replace(/\/$/, '');
 
 class ApiError extends Error {
+  code?: string;
   status: number;
 
-  constructor(message: string, status: number) {
+  constructor(message: string, status: number, code?: string) {
     super(message);
+    this.code = code;
     this.status = status;
   }
 }
@@ -50,15 +54,17 @@ async function request<TResponse>(
 
   if (!response.ok) {
     let message = `Request failed with status ${response.status}`;
+    let code: string | undefined;
     try {
       const payload = (await response.json()) as ApiErrorPayload;
       if (payload.error) {
         message = payload.error;
       }
+      code = payload.code;
     } catch {
       // Ignore parse errors.
     }
-    throw new ApiError(message, response.status);
+    throw new ApiError(message, response.status, code);
   }
 
   return (await response.json()) as TResponse;
@@ -110,11 +116,13 @@ export async function updateDesign(
   input: {
     materials: DesignState;
     name: string;
+    version: number;
   },
 ): Promise<SavedDesign> {
-  const payload: CreateDesignRequest = {
+  const payload: UpdateDesignRequest = {
     name: input.name,
     selections: input.materials,
+    version: input.version,
   };
   const response = await request<DesignRecordDTO>(`/designs/${designID}`, 'PUT', payload, token);
   return toSavedDesign(response);
@@ -20,6 +20,7 @@ function toSavedDesign(value: unknown): SavedDesign | null {
   const updatedAt = value.updatedAt;
   const status = value.status;
   const rejectionReason = value.rejectionReason;
+  const version = value.version;
 
   if (
     typeof id !== 'string' ||
@@ -39,6 +40,7 @@ function toSavedDesign(value: unknown): SavedDesign | null {
     rejectionReason: typeof rejectionReason === 'string' ? rejectionReason : undefined,
     status: isDesignStatus(status) ? status : 'DRAFT',
     updatedAt: typeof updatedAt === 'string' ? updatedAt : undefined,
+    version: typeof version === 'number' ? version : 1,
   };
 }
 
@@ -6,6 +6,10 @@ export type UserProfile = {
 };
 
 export type CatalogMaterial = {
+  allowedColors?: string[];
+  allowedFinishes?: FinishType[];
+  allowedPatternIds?: PatternId[];
+  defaultColorHex?: string;
   detail?: string;
   key: string;
   name: string;
@@ -38,12 +42,15 @@ export type LoginResponse = {
 
 export type DesignRecordDTO = {
   createdAt: string;
+  editable: boolean;
   id: string;
   name: string;
   rejectionReason?: string;
   selections: DesignState;
   status: DesignStatus;
   updatedAt: string;
+  version: number;
+  warnings?: string[];
 };
 
 export type CreateDesignRequest = {
@@ -51,6 +58,10 @@ export type CreateDesignRequest = {
   selections: DesignState;
 };
 
+export type UpdateDesignRequest = CreateDesignRequest & {
+  version: number;
+};
+
 export type ListDesignsResponse = {
   designs: DesignRecordDTO[];
 };
@@ -71,5 +82,6 @@ export function toSavedDesign(record: DesignRecordDTO): SavedDesign {
     rejectionReason: record.rejectionReason,
     status: normalizeStatus(record.status),
     updatedAt: record.updatedAt,
+    version: record.version,
   };
 }
@@ -19,4 +19,5 @@ export type SavedDesign = {
   rejectionReason?: string;
   status: DesignStatus;
   updatedAt?: string;
+  version: number;
 };